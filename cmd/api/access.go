@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"dev.theenthusiast.text-bin/internal/data"
+)
+
+// textAccessTokenTTL is how long an access token for a password protected text stays valid
+const textAccessTokenTTL = 15 * time.Minute
+
+// editSecretHeader is the header that carries the edit secret of an anonymous text, which is
+// returned once in the same header and in the response body when the text is created
+const editSecretHeader = "X-Edit-Secret"
+
+// readText fetches a text for showHandler and the raw endpoint. A share link passed in the token
+// query parameter gives access to the text whatever its visibility or password. Without one, readers
+// other than the owner and the users it is shared with must unlock a password protected text first.
+// A burn after read text is burned once it has been unlocked. The error response is written here
+// when the text can't be shown.
+func (app *application) readText(w http.ResponseWriter, r *http.Request, slug string) (*data.Text, bool) {
+	user := app.contextGetUser(r)
+	var userID *int64
+	if !user.IsAnonymous() {
+		userID = &user.ID
+	}
+
+	var text *data.Text
+	var err error
+
+	shareLink := r.URL.Query().Get("token")
+	if shareLink != "" {
+		text, err = app.models.Texts.ReadWithShareLink(slug, shareLink)
+	} else {
+		text, err = app.models.Texts.Read(slug, userID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTextBurned):
+			app.textGoneResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if shareLink == "" && text.PasswordProtected && !text.SharedWith(userID) && !app.unlockText(w, r, text) {
+		return nil, false
+	}
+
+	err = app.models.Texts.Burn(text, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTextBurned):
+			app.textGoneResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return text, true
+}
+
+// unlockText checks the X-Text-Access-Token header, or failing that the X-Text-Password header,
+// against a password protected text.
+func (app *application) unlockText(w http.ResponseWriter, r *http.Request, text *data.Text) bool {
+	if token := r.Header.Get("X-Text-Access-Token"); token != "" {
+		valid, err := app.models.Tokens.ValidForText(data.ScopeTextAccess, token, text.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return false
+		}
+		if !valid {
+			app.invalidTextPasswordResponse(w, r)
+			return false
+		}
+		return true
+	}
+
+	password := r.Header.Get("X-Text-Password")
+	if password == "" {
+		app.textPasswordRequiredResponse(w, r)
+		return false
+	}
+
+	return app.checkTextPassword(w, r, text, password)
+}
+
+// checkTextPassword compares the password with the access password of the text. Failed attempts
+// are counted per slug, and once too many have failed the text can't be unlocked by password
+// until the window is over.
+func (app *application) checkTextPassword(w http.ResponseWriter, r *http.Request, text *data.Text, password string) bool {
+	if retryAfter, blocked := app.textPasswordAttempts.blocked(text.Slug); blocked {
+		app.rateLimitExceededResponse(w, r, retryAfter)
+		return false
+	}
+
+	match, err := text.Password.Matches(password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !match {
+		app.textPasswordAttempts.fail(text.Slug)
+		app.invalidTextPasswordResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// createTextAccessTokenHandler will be used to exchange the password of a password protected text
+// for a short-lived access token, so that clients don't have to send the password on every request
+func (app *application) createTextAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	slug, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	var userID *int64
+	if !user.IsAnonymous() {
+		userID = &user.ID
+	}
+
+	text, err := app.models.Texts.Read(slug, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTextBurned):
+			app.textGoneResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !text.PasswordProtected {
+		app.failedValidationResponse(w, r, map[string]string{"text": "is not password protected"})
+		return
+	}
+
+	if !app.checkTextPassword(w, r, text, input.Password) {
+		return
+	}
+
+	token, err := app.models.Tokens.NewForText(text.ID, textAccessTokenTTL, data.ScopeTextAccess)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"access_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// attemptLimiter counts failed attempts per key, such as the slug of a password protected text,
+// and blocks the key once the maximum number of failures is reached within the window.
+type attemptLimiter struct {
+	mu       sync.Mutex
+	max      int
+	window   time.Duration
+	attempts map[string]*attempts
+}
+
+type attempts struct {
+	failures int
+	start    time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      max,
+		window:   window,
+		attempts: make(map[string]*attempts),
+	}
+}
+
+// blocked reports whether the key has run out of attempts and, if so, how long until the window ends
+func (l *attemptLimiter) blocked(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.attempts[key]
+	if !ok || a.failures < l.max {
+		return 0, false
+	}
+
+	remaining := time.Until(a.start.Add(l.window))
+	if remaining <= 0 {
+		delete(l.attempts, key)
+		return 0, false
+	}
+	return remaining, true
+}
+
+// fail records a failed attempt for the key. Windows that have ended are pruned at the same time,
+// so keys that are never tried again don't stay in memory.
+func (l *attemptLimiter) fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for k, a := range l.attempts {
+		if now.Sub(a.start) >= l.window {
+			delete(l.attempts, k)
+		}
+	}
+
+	a, ok := l.attempts[key]
+	if !ok {
+		a = &attempts{start: now}
+		l.attempts[key] = a
+	}
+	a.failures++
+}
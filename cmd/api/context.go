@@ -9,7 +9,13 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey        = contextKey("user")
+	sessionContextKey     = contextKey("session")
+	apiKeyContextKey      = contextKey("apiKey")
+	scopedContextKey      = contextKey("scoped")
+	permissionsContextKey = contextKey("permissions")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -23,3 +29,53 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// contextSetSession stores the ID of the authentication token the request was made with
+func (app *application) contextSetSession(r *http.Request, sessionID int64) *http.Request {
+	ctx := context.WithValue(r.Context(), sessionContextKey, sessionID)
+	return r.WithContext(ctx)
+}
+
+// contextGetSession returns the ID of the authentication token the request was made with, or 0
+// for anonymous requests
+func (app *application) contextGetSession(r *http.Request) int64 {
+	sessionID, _ := r.Context().Value(sessionContextKey).(int64)
+	return sessionID
+}
+
+// contextSetAPIKey stores the API key the request was made with
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// contextGetAPIKey returns the API key the request was made with, or nil when it wasn't made with one
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
+
+// contextSetScoped records that the scope of the route has been checked against the API key of the request
+func (app *application) contextSetScoped(r *http.Request) *http.Request {
+	ctx := context.WithValue(r.Context(), scopedContextKey, true)
+	return r.WithContext(ctx)
+}
+
+// contextIsScoped reports whether the scope of the route has been checked against the API key of the request
+func (app *application) contextIsScoped(r *http.Request) bool {
+	scoped, _ := r.Context().Value(scopedContextKey).(bool)
+	return scoped
+}
+
+// contextSetPermissions stores the permissions of the user that the signed token of the request carries
+func (app *application) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+// contextGetPermissions returns the permissions carried by the signed token of the request, and whether
+// the request was made with one
+func (app *application) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions, ok
+}
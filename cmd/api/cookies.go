@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"dev.theenthusiast.text-bin/internal/data"
+)
+
+// Browser clients can keep their session in cookies rather than handling the tokens themselves. The
+// authentication token and refresh token cookies can't be read by scripts; the CSRF token cookie can,
+// and its value has to be sent back in the X-CSRF-Token header of requests that change anything, which
+// a page on another site can't do. The __Host- prefix keeps other hosts of the same site from setting
+// the cookies.
+const (
+	sessionCookieName = "__Host-session"
+	refreshCookieName = "__Secure-refresh"
+	csrfCookieName    = "__Host-csrf"
+	csrfHeader        = "X-CSRF-Token"
+)
+
+// refreshCookiePath limits the refresh token cookie to the token routes, so it isn't sent along with
+// every request
+const refreshCookiePath = "/v1/tokens"
+
+// setSessionCookies sets the cookies of a session that was just created or refreshed, and returns the
+// new CSRF token
+func (app *application) setSessionCookies(w http.ResponseWriter, accessToken, refreshToken *data.Token) (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	csrfToken := base64.RawURLEncoding.EncodeToString(randomBytes)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    accessToken.Plaintext,
+		Path:     "/",
+		Expires:  accessToken.Expiry,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    refreshToken.Plaintext,
+		Path:     refreshCookiePath,
+		Expires:  refreshToken.Expiry,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    csrfToken,
+		Path:     "/",
+		Expires:  refreshToken.Expiry,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return csrfToken, nil
+}
+
+// writeSessionCookies sets the cookies of a session and writes the response to a browser client, which
+// carries the CSRF token and when the authentication token expires rather than the tokens themselves
+func (app *application) writeSessionCookies(w http.ResponseWriter, r *http.Request, status int, accessToken, refreshToken *data.Token) {
+	csrfToken, err := app.setSessionCookies(w, accessToken, refreshToken)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, status, envelope{"csrf_token": csrfToken, "expiry": accessToken.Expiry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// clearSessionCookies removes the cookies of a session that has ended
+func (app *application) clearSessionCookies(w http.ResponseWriter) {
+	for _, cookie := range []struct{ name, path string }{
+		{sessionCookieName, "/"},
+		{refreshCookieName, refreshCookiePath},
+		{csrfCookieName, "/"},
+	} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     cookie.name,
+			Value:    "",
+			Path:     cookie.path,
+			Expires:  time.Unix(0, 0),
+			MaxAge:   -1,
+			Secure:   true,
+			HttpOnly: cookie.name != csrfCookieName,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+// validCSRFToken reports whether the X-CSRF-Token header of the request matches its CSRF token cookie
+func (app *application) validCSRFToken(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(csrfHeader)), []byte(cookie.Value)) == 1
+}
+
+// isSafeMethod reports whether the request method only reads, so it needs no CSRF protection
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
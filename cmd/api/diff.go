@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"dev.theenthusiast.text-bin/internal/data"
+	"dev.theenthusiast.text-bin/internal/diff"
+	"dev.theenthusiast.text-bin/internal/validator"
+)
+
+// diffTextHandler will be used to show the differences between two versions of a text, or between
+// a text and another text given by the "against" query parameter. Both sides are fetched through
+// Texts.Get so a private text can never be read through a diff.
+func (app *application) diffTextHandler(w http.ResponseWriter, r *http.Request) {
+	slug, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Against string
+		From    int
+		To      int
+		Context int
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Against = app.readString(qs, "against", "")
+	input.From = app.readInt(qs, "from", 0, v)
+	input.To = app.readInt(qs, "to", 0, v)
+	input.Context = app.readInt(qs, "context", 3, v)
+
+	v.Check(input.From >= 0, "from", "must be a positive integer")
+	v.Check(input.To >= 0, "to", "must be a positive integer")
+	v.Check(input.Context >= 0, "context", "must not be negative")
+	v.Check(input.Context <= 100, "context", "must be a maximum of 100")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	var userID *int64
+	if !user.IsAnonymous() {
+		userID = &user.ID
+	}
+
+	fromText, err := app.models.Texts.Get(slug, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	toText := fromText
+	if input.Against != "" && input.Against != slug {
+		toText, err = app.models.Texts.Get(input.Against, userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	// When comparing a text with itself and no versions are given, show the latest change
+	if toText == fromText && input.From == 0 && input.To == 0 && fromText.Version > 1 {
+		input.From = int(fromText.Version) - 1
+	}
+
+	fromContent, fromVersion, err := app.textContentAt(fromText, input.From)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	toContent, toVersion, err := app.textContentAt(toText, input.To)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	fromName := fmt.Sprintf("%s@%d", fromText.Slug, fromVersion)
+	toName := fmt.Sprintf("%s@%d", toText.Slug, toVersion)
+
+	hunks := diff.Hunks(diff.Lines(fromContent, toContent), input.Context)
+
+	env := envelope{
+		"from":    fromName,
+		"to":      toName,
+		"unified": diff.Unified(fromName, toName, hunks),
+		"hunks":   hunks,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// textContentAt returns the content of the text at the given version along with the version number.
+// A version of 0 means the current content.
+func (app *application) textContentAt(text *data.Text, version int) (string, int32, error) {
+	if version == 0 || int32(version) == text.Version {
+		return text.Content, text.Version, nil
+	}
+
+	revision, err := app.models.Revisions.Get(text.ID, int32(version))
+	if err != nil {
+		return "", 0, err
+	}
+
+	return revision.Content, revision.Version, nil
+}
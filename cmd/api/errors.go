@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // This is a generic error message that will be returned to the client
@@ -65,12 +68,64 @@ func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+func (app *application) invalidRefreshTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "Invalid or expired refresh token, please log in again"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) invalidCSRFTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "Invalid or missing CSRF token, send the value of the __Host-csrf cookie in the X-CSRF-Token header"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	message := "You must be authenticated to access this resource"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
 }
 
+func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "Your user account must be activated to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) missingScopeResponse(w http.ResponseWriter, r *http.Request, scope string) {
+	message := fmt.Sprintf("This API key does not have the %s scope needed to access this resource", scope)
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) apiKeyNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "This resource cannot be accessed with an API key"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) textGoneResponse(w http.ResponseWriter, r *http.Request) {
+	message := "The requested text was deleted after it was read and is no longer available"
+	app.errorResponse(w, r, http.StatusGone, message)
+}
+
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "You are not permitted to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (app *application) textPasswordRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "This text is password protected, provide the password in the X-Text-Password header or an access token in the X-Text-Access-Token header"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) invalidTextPasswordResponse(w http.ResponseWriter, r *http.Request) {
+	message := "Invalid text password or access token"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	message := "Rate limit exceeded, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+// lastOwnerResponse writes the failed validation response for a change that would leave the organization
+// without any owner
+func (app *application) lastOwnerResponse(w http.ResponseWriter, r *http.Request) {
+	app.failedValidationResponse(w, r, map[string]string{"role": "the organization must keep at least one owner"})
+}
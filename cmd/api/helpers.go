@@ -6,12 +6,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"dev.theenthusiast.text-bin/internal/data"
+	"dev.theenthusiast.text-bin/internal/validator"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -118,28 +124,211 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst int
 	return nil
 }
 
-// expirationTime calculates the expiration time based on the expiresValue and expiresUnit
-func (app *application) expirationTime(expiresValue int, expiresUnit string) (time.Time, error) {
+// readPlainText reads the whole request body as text. The body is limited to 1MB, the same as readJSON,
+// and must be valid UTF-8 so that it can be stored as a text.
+func (app *application) readPlainText(w http.ResponseWriter, r *http.Request) (string, error) {
+	maxBytes := 1_048_576
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return "", fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		}
+		return "", err
+	}
+
+	if len(body) == 0 {
+		return "", errors.New("body must not be empty")
+	}
+	if !utf8.Valid(body) {
+		return "", errors.New("body must be valid UTF-8 text")
+	}
+
+	return string(body), nil
+}
+
+// readMultipartFile parses a multipart/form-data body and returns the content and the name of the file
+// uploaded in the given field. An empty content is returned if no file was uploaded in that field.
+func (app *application) readMultipartFile(w http.ResponseWriter, r *http.Request, key string) (string, string, error) {
+	maxBytes := 1_048_576
+	// Leave some room for the multipart boundaries and the other form fields
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes)+64*1024)
+
+	err := r.ParseMultipartForm(int64(maxBytes))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return "", "", fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		}
+		return "", "", fmt.Errorf("body contains a badly-formed multipart form: %v", err)
+	}
+
+	file, header, err := r.FormFile(key)
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			return "", "", nil
+		}
+		return "", "", err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, int64(maxBytes)+1))
+	if err != nil {
+		return "", "", err
+	}
+	if len(content) > maxBytes {
+		return "", "", fmt.Errorf("file must not be larger than %d bytes", maxBytes)
+	}
+	if !utf8.Valid(content) {
+		return "", "", errors.New("file must be valid UTF-8 text")
+	}
+
+	return string(content), header.Filename, nil
+}
+
+// writePlainText writes the message as a text/plain response with the given status and headers
+func (app *application) writePlainText(w http.ResponseWriter, status int, message string, headers http.Header) error {
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	_, err := io.WriteString(w, message)
+	return err
+}
+
+// prefersPlainText reports whether the Accept header of the request lists text/plain before application/json.
+// Wildcards are ignored, so clients that accept anything still get JSON.
+func (app *application) prefersPlainText(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/plain":
+			return true
+		case "application/json":
+			return false
+		}
+	}
+	return false
+}
+
+// rawTextURL returns the absolute URL of the raw content of the text with the given slug.
+// The request may be nil for texts that were not created over HTTP.
+func (app *application) rawTextURL(r *http.Request, slug string) string {
+	return fmt.Sprintf("%s/raw/%s", app.baseURL(r), url.PathEscape(slug))
+}
+
+// clientIP returns the IP address the request came from
+func (app *application) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// baseURL returns the public base URL of the API. The configured base URL is used when set,
+// otherwise it is based on the host and scheme the request was made with.
+func (app *application) baseURL(r *http.Request) string {
+	baseURL := strings.TrimSuffix(app.config.baseURL, "/")
+
+	if baseURL == "" && r != nil {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		baseURL = fmt.Sprintf("%s://%s", scheme, r.Host)
+	}
+
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("http://localhost:%d", app.config.port)
+	}
+
+	return baseURL
+}
+
+// readString returns a string value from the query string, or the provided default value if no matching key could be found
+func (app *application) readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	return s
+}
+
+// readInt reads a string value from the query string and converts it to an integer before returning.
+// If no matching key could be found it returns the provided default value. If the value couldn't be
+// converted to an integer, then we record an error message in the provided Validator instance.
+func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+	return i
+}
+
+// expirationTime calculates the expiration time based on the expiresValue and expiresUnit. When neither
+// is given, the default lifetime from the user's expiry policy is applied. A nil time means the text
+// never expires, either because "never" was asked for or because the policy has no default lifetime.
+// The maximum lifetime of the policy is enforced by data.ValidateText.
+func (app *application) expirationTime(expiresValue int, expiresUnit string, user *data.User) (*time.Time, error) {
 	now := time.Now()
 
+	if expiresUnit == "" && expiresValue == 0 {
+		policy := app.expiryPolicy(user)
+		if policy.Default == 0 {
+			return nil, nil
+		}
+		expires := now.Add(policy.Default)
+		return &expires, nil
+	}
+
+	var expires time.Time
+
 	switch expiresUnit {
+	case "never":
+		return nil, nil
 	case "seconds":
-		return now.Add(time.Duration(expiresValue) * time.Second), nil
+		expires = now.Add(time.Duration(expiresValue) * time.Second)
 	case "minutes":
-		return now.Add(time.Duration(expiresValue) * time.Minute), nil
+		expires = now.Add(time.Duration(expiresValue) * time.Minute)
 	case "hours":
-		return now.Add(time.Duration(expiresValue) * time.Hour), nil
+		expires = now.Add(time.Duration(expiresValue) * time.Hour)
 	case "days":
-		return now.Add(time.Duration(expiresValue) * time.Hour * 24), nil
+		expires = now.Add(time.Duration(expiresValue) * time.Hour * 24)
 	case "weeks":
-		return now.Add(time.Duration(expiresValue) * time.Hour * 24 * 7), nil
+		expires = now.Add(time.Duration(expiresValue) * time.Hour * 24 * 7)
 	case "months":
-		return now.AddDate(0, expiresValue, 0), nil
+		expires = now.AddDate(0, expiresValue, 0)
 	case "years":
-		return now.AddDate(expiresValue, 0, 0), nil
+		expires = now.AddDate(expiresValue, 0, 0)
 	default:
-		return time.Time{}, fmt.Errorf("invalid expires unit: %s", expiresUnit)
+		return nil, fmt.Errorf("invalid expires unit: %s", expiresUnit)
+	}
+
+	return &expires, nil
+}
+
+// expiryPolicy returns the default and maximum lifetime of texts created or updated by the user
+func (app *application) expiryPolicy(user *data.User) data.ExpiryPolicy {
+	if user.IsAnonymous() {
+		return app.config.expiry.anonymous
 	}
+	return app.config.expiry.authenticated
 }
 
 // The background() helper accepts an arbitrary function as a parameter.
@@ -147,7 +336,7 @@ func (app *application) background(fn func()) {
 	app.wg.Add(1)
 	// Launch a background goroutine.
 	go func() {
-		app.wg.Done()
+		defer app.wg.Done()
 		// Recover any panic.
 		defer func() {
 			if err := recover(); err != nil {
@@ -169,3 +358,13 @@ func (app *application) generateSlug(title string, content string) string {
 
 	return fmt.Sprintf("%s-%s", sanitized, hashString)
 }
+
+// userPermissions returns the permissions of the user of the request. They are taken from the signed
+// token the request was made with, if any, and looked up otherwise.
+func (app *application) userPermissions(r *http.Request) (data.Permissions, error) {
+	if permissions, ok := app.contextGetPermissions(r); ok {
+		return permissions, nil
+	}
+
+	return app.models.Permissions.GetAllForUser(app.contextGetUser(r).ID)
+}
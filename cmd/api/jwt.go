@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"dev.theenthusiast.text-bin/internal/data"
+	"dev.theenthusiast.text-bin/internal/jwt"
+)
+
+const (
+	tokenModeOpaque = "opaque"
+	tokenModeJWT    = "jwt"
+)
+
+// revokedSessions is the in-memory copy of the revoked sessions table, checked for every request made
+// with a signed token so that verifying one doesn't need the database
+type revokedSessions struct {
+	mu       sync.RWMutex
+	sessions map[int64]time.Time
+}
+
+func (rs *revokedSessions) contains(sessionID int64) bool {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	_, ok := rs.sessions[sessionID]
+	return ok
+}
+
+func (rs *revokedSessions) replace(sessions map[int64]time.Time) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.sessions = sessions
+}
+
+// storedAccessTokenTTL is the lifetime of the authentication tokens stored along with a session, which is
+// zero when signed tokens are issued instead
+func (app *application) storedAccessTokenTTL() time.Duration {
+	if app.config.auth.tokenMode == tokenModeJWT {
+		return 0
+	}
+	return app.config.auth.accessTokenTTL
+}
+
+// newSignedToken issues a signed authentication token for the session of the user. It carries what is
+// needed to authenticate requests without the database, so changes to the account or its permissions
+// only show in the tokens issued after them.
+func (app *application) newSignedToken(user *data.User, sessionID int64) (*data.Token, error) {
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiry := time.Unix(now.Add(app.config.auth.accessTokenTTL).Unix(), 0)
+
+	plaintext, err := app.signer.Sign(jwt.Claims{
+		Subject:   user.ID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiry.Unix(),
+		SessionID: sessionID,
+		Name:      user.Name,
+		Email:     user.Email,
+		Activated: user.Activated,
+		Scope:     strings.Join(permissions, " "),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Token{Plaintext: plaintext, Expiry: expiry, Scope: data.ScopeAuthentication}, nil
+}
+
+// verifySignedToken returns the user a signed token was issued to, the ID of its session and the
+// permissions it carries. Tokens of revoked sessions are refused with jwt.ErrInvalidToken.
+func (app *application) verifySignedToken(token string) (*data.User, int64, data.Permissions, error) {
+	claims, err := app.signer.Verify(token)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	if app.revokedSessions.contains(claims.SessionID) {
+		return nil, 0, nil, jwt.ErrInvalidToken
+	}
+
+	user := &data.User{
+		ID:        claims.Subject,
+		Name:      claims.Name,
+		Email:     claims.Email,
+		Activated: claims.Activated,
+	}
+
+	return user, claims.SessionID, data.Permissions(claims.Scopes()), nil
+}
+
+// loadRevokedSessions replaces the in-memory copy of the revoked sessions with the table. It is called
+// after a session has been revoked so that the instance refuses its signed tokens right away.
+func (app *application) loadRevokedSessions() {
+	if app.signer == nil {
+		return
+	}
+
+	sessions, err := app.models.Tokens.GetAllRevokedSessions()
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"task": "load revoked sessions"})
+		return
+	}
+
+	app.revokedSessions.replace(sessions)
+}
+
+// startRevokedSessionsRefresh launches the background worker that keeps the in-memory copy of the revoked
+// sessions up to date, picking up sessions revoked through other instances. The worker is tracked by
+// app.wg and stops once app.shutdown is closed.
+func (app *application) startRevokedSessionsRefresh() {
+	if app.signer == nil {
+		return
+	}
+
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.auth.revocationRefresh)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				app.loadRevokedSessions()
+			case <-app.shutdown:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"dev.theenthusiast.text-bin/internal/data"
+	"dev.theenthusiast.text-bin/internal/validator"
+)
+
+// shareLinkDefaultTTL is how long a share link stays valid when no expiry is given
+const shareLinkDefaultTTL = 7 * 24 * time.Hour
+
+// listShareLinksHandler will be used to list the share links of a text that can still be used.
+// Only the owner of the text can see them, and the tokens themselves are never shown again.
+func (app *application) listShareLinksHandler(w http.ResponseWriter, r *http.Request) {
+	text, ok := app.ownedText(w, r)
+	if !ok {
+		return
+	}
+
+	links, err := app.models.Tokens.GetAllShareLinksForText(text.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"share_links": links}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createShareLinkHandler will be used to create a link that lets anyone read the text without an
+// account, even when it is private. The link expires, and can be limited to a number of views.
+func (app *application) createShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	text, ok := app.ownedText(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		ExpiresValue int    `json:"expiresValue"`
+		ExpiresUnit  string `json:"expiresUnit"`
+		MaxViews     *int32 `json:"max_views"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	link := &data.ShareLink{
+		TextID:   text.ID,
+		Expiry:   time.Now().Add(shareLinkDefaultTTL),
+		MaxViews: input.MaxViews,
+	}
+
+	if input.ExpiresUnit != "" || input.ExpiresValue != 0 {
+		if input.ExpiresUnit == "never" {
+			app.badRequestResponse(w, r, errors.New("share links must expire"))
+			return
+		}
+		expires, err := app.expirationTime(input.ExpiresValue, input.ExpiresUnit, user)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		link.Expiry = *expires
+	}
+
+	v := validator.New()
+	if data.ValidateShareLink(v, link); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	link, err = app.models.Tokens.NewShareLink(user.ID, text.ID, time.Until(link.Expiry), link.MaxViews)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	link.URL = fmt.Sprintf("%s/v1/texts/%s?token=%s", app.baseURL(r), url.PathEscape(text.Slug), url.QueryEscape(link.Token))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"share_link": link}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeShareLinkHandler will be used to revoke a share link before it expires
+func (app *application) revokeShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	text, ok := app.ownedText(w, r)
+	if !ok {
+		return
+	}
+
+	linkID, err := app.readIntParam(r, "linkID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Tokens.DeleteShareLink(linkID, text.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "share link successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
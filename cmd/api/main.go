@@ -3,17 +3,21 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
 	"dev.theenthusiast.text-bin/internal/data"
 	"dev.theenthusiast.text-bin/internal/jsonlog"
+	"dev.theenthusiast.text-bin/internal/jwt"
 	"dev.theenthusiast.text-bin/internal/mailer"
+	"dev.theenthusiast.text-bin/internal/ratelimit"
 	_ "github.com/lib/pq"
 )
 
@@ -24,9 +28,10 @@ var (
 
 // Config struct will be used to hold all the configuration settings of the application
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port    int
+	env     string
+	baseURL string
+	db      struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
@@ -39,15 +44,63 @@ type config struct {
 		password string
 		sender   string
 	}
+	tcp struct {
+		port        int
+		expiry      time.Duration
+		readTimeout time.Duration
+		visibility  string
+		maxConns    int
+	}
+	expiry struct {
+		anonymous     data.ExpiryPolicy
+		authenticated data.ExpiryPolicy
+	}
+	sweeper struct {
+		interval        time.Duration
+		batchSize       int
+		burnedRetention time.Duration
+	}
+	textPassword struct {
+		maxAttempts int
+		window      time.Duration
+	}
+	limiter struct {
+		enabled bool
+		store   string
+		rps     float64
+		burst   int
+		strict  struct {
+			rps   float64
+			burst int
+		}
+	}
+	auth struct {
+		accessTokenTTL    time.Duration
+		refreshTokenTTL   time.Duration
+		tokenMode         string
+		jwtKeys           string
+		revocationRefresh time.Duration
+	}
+	cors struct {
+		trustedOrigins []string
+	}
 }
 
 // Application struct will be used to hold all the dependencies of the application
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config   config
+	logger   *jsonlog.Logger
+	models   data.Models
+	mailer   mailer.Mailer
+	wg       sync.WaitGroup
+	shutdown chan struct{}
+
+	textPasswordAttempts *attemptLimiter
+	rateLimitStore       ratelimit.Store
+	limiter              *ratelimit.Limiter
+	strictLimiter        *ratelimit.Limiter
+	signer               *jwt.Signer
+	revokedSessions      *revokedSessions
 }
 
 func main() {
@@ -58,6 +111,7 @@ func main() {
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
 	flag.StringVar(&cfg.db.dsn, "dsn", os.Getenv("DSN"), "PostgreSQL DSN")
+	flag.StringVar(&cfg.baseURL, "base-url", os.Getenv("BASE_URL"), "Public base URL used in links to texts (defaults to the request host)")
 
 	// Read the connection pool settings from command-line flags into the config struct.
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
@@ -70,6 +124,55 @@ func main() {
 	flag.StringVar(&cfg.smtp.password, "smtp-password", os.Getenv("SMTP_PASSWORD"), "SMTP password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "TextBin <mailtrap@theenthusiast.dev>", "SMTP sender")
 
+	// Read the expiry policy for texts. A default of 0 means texts never expire unless asked to,
+	// and a maximum of 0 allows texts that never expire.
+	flag.DurationVar(&cfg.expiry.anonymous.Default, "expiry-anonymous-default", 7*24*time.Hour, "Default lifetime of texts created by anonymous users")
+	flag.DurationVar(&cfg.expiry.anonymous.Max, "expiry-anonymous-max", 365*24*time.Hour, "Maximum lifetime of texts created by anonymous users (0 for no limit)")
+	flag.DurationVar(&cfg.expiry.authenticated.Default, "expiry-authenticated-default", 0, "Default lifetime of texts created by authenticated users (0 for never)")
+	flag.DurationVar(&cfg.expiry.authenticated.Max, "expiry-authenticated-max", 0, "Maximum lifetime of texts created by authenticated users (0 for no limit)")
+
+	// Read the lifetimes of the tokens issued when logging in. Refresh tokens get a new lifetime each time they are used.
+	flag.DurationVar(&cfg.auth.accessTokenTTL, "auth-access-token-ttl", 15*time.Minute, "Lifetime of authentication tokens")
+	flag.DurationVar(&cfg.auth.refreshTokenTTL, "auth-refresh-token-ttl", 30*24*time.Hour, "Lifetime of refresh tokens")
+
+	// Read the kind of authentication tokens issued. Signed tokens are verified without the database, and refused
+	// once their session is revoked. They are accepted whenever signing keys are given, so that switching back to
+	// opaque tokens doesn't log everyone out. The first key signs new tokens, the others are only used to verify.
+	flag.StringVar(&cfg.auth.tokenMode, "auth-token-mode", tokenModeOpaque, "Kind of authentication tokens issued, jwt for signed tokens (opaque|jwt)")
+	flag.StringVar(&cfg.auth.jwtKeys, "auth-jwt-keys", os.Getenv("JWT_KEYS"), "Comma separated id:secret keys for signed tokens, the first one signing new tokens")
+	flag.DurationVar(&cfg.auth.revocationRefresh, "auth-revocation-refresh", 30*time.Second, "Interval between reloads of the revoked sessions refused for signed tokens")
+
+	// Read the settings for the termbin-style TCP paste listener. It is disabled unless a port is given.
+	flag.IntVar(&cfg.tcp.port, "tcp-port", 0, "TCP paste listener port (0 disables the listener)")
+	flag.DurationVar(&cfg.tcp.expiry, "tcp-expiry", 7*24*time.Hour, "Expiry of texts created through the TCP paste listener, within -expiry-anonymous-max (0 for never, if anonymous texts may never expire)")
+	flag.DurationVar(&cfg.tcp.readTimeout, "tcp-read-timeout", 3*time.Second, "Idle time after which the TCP paste listener stops reading")
+	flag.StringVar(&cfg.tcp.visibility, "tcp-visibility", data.VisibilityUnlisted, "Visibility of texts created through the TCP paste listener (public|unlisted)")
+	flag.IntVar(&cfg.tcp.maxConns, "tcp-max-conns", 100, "Maximum number of connections the TCP paste listener handles at once")
+
+	// Read the settings for the background worker that purges expired texts and tokens, and forgets burned texts.
+	flag.DurationVar(&cfg.sweeper.interval, "expiry-sweep-interval", 5*time.Minute, "Interval between purges of expired texts and tokens (0 disables the sweeper)")
+	flag.IntVar(&cfg.sweeper.batchSize, "expiry-sweep-batch-size", 1000, "Maximum number of expired texts deleted per batch")
+	flag.DurationVar(&cfg.sweeper.burnedRetention, "burned-texts-retention", 30*24*time.Hour, "How long burned texts are reported as gone rather than not found")
+
+	// Read the limits on failed password attempts for password protected texts, counted per text.
+	flag.IntVar(&cfg.textPassword.maxAttempts, "text-password-max-attempts", 5, "Maximum failed password attempts per text within the window")
+	flag.DurationVar(&cfg.textPassword.window, "text-password-window", 15*time.Minute, "Window in which failed password attempts for a text are counted")
+
+	// Read the rate limits, counted per IP address for every request and per user as well for authenticated ones.
+	// The strict limits apply on top of them to authentication, password resets and text creation.
+	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.StringVar(&cfg.limiter.store, "limiter-store", "memory", "Rate limiter store, postgres to share the limits between instances (memory|postgres)")
+	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
+	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
+	flag.Float64Var(&cfg.limiter.strict.rps, "limiter-strict-rps", 0.1, "Strict rate limiter maximum requests per second")
+	flag.IntVar(&cfg.limiter.strict.burst, "limiter-strict-burst", 5, "Strict rate limiter maximum burst")
+
+	// Read the origins of the browser clients allowed to make cross-origin requests, which may send cookies along
+	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
+		cfg.cors.trustedOrigins = strings.Fields(val)
+		return nil
+	})
+
 	// Create a new version boolean flag with the default value of false.
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
@@ -86,6 +189,61 @@ func main() {
 	// instance of logger
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
+	// A policy with a maximum lifetime needs a default that fits within it, otherwise texts created
+	// without an expiry would always fail validation.
+	for _, policy := range []data.ExpiryPolicy{cfg.expiry.anonymous, cfg.expiry.authenticated} {
+		if policy.Max > 0 && (policy.Default == 0 || policy.Default > policy.Max) {
+			logger.PrintFatal(errors.New("the default lifetime of texts must be set and must not exceed the maximum lifetime"), nil)
+		}
+	}
+
+	// A batch size below 1 would never delete anything, and the sweeper would keep asking for the next batch
+	if cfg.sweeper.interval > 0 && cfg.sweeper.batchSize < 1 {
+		logger.PrintFatal(errors.New("the expiry sweeper batch size must be at least 1"), nil)
+	}
+
+	// TCP pastes are anonymous texts, so their expiry has to pass the anonymous policy or every paste would fail validation
+	if cfg.tcp.port > 0 && (cfg.tcp.expiry < 0 || (cfg.expiry.anonymous.Max > 0 && (cfg.tcp.expiry == 0 || cfg.tcp.expiry > cfg.expiry.anonymous.Max))) {
+		logger.PrintFatal(fmt.Errorf("the expiry of texts created through the TCP paste listener must be set and must not exceed the maximum lifetime of anonymous texts (%s)", cfg.expiry.anonymous.Max), nil)
+	}
+	if cfg.tcp.visibility != data.VisibilityPublic && cfg.tcp.visibility != data.VisibilityUnlisted {
+		logger.PrintFatal(errors.New("the visibility of texts created through the TCP paste listener must be public or unlisted"), nil)
+	}
+	if cfg.tcp.port > 0 && cfg.tcp.maxConns < 1 {
+		logger.PrintFatal(errors.New("the TCP paste listener must accept at least 1 connection at once"), nil)
+	}
+
+	if cfg.limiter.enabled && (cfg.limiter.rps <= 0 || cfg.limiter.burst < 1 || cfg.limiter.strict.rps <= 0 || cfg.limiter.strict.burst < 1) {
+		logger.PrintFatal(errors.New("the rate limiter needs a positive rate and a burst of at least 1"), nil)
+	}
+	if cfg.limiter.store != "memory" && cfg.limiter.store != "postgres" {
+		logger.PrintFatal(errors.New("the rate limiter store must be memory or postgres"), nil)
+	}
+
+	if cfg.auth.tokenMode != tokenModeOpaque && cfg.auth.tokenMode != tokenModeJWT {
+		logger.PrintFatal(errors.New("the authentication token mode must be opaque or jwt"), nil)
+	}
+	if cfg.auth.accessTokenTTL <= 0 || cfg.auth.accessTokenTTL > cfg.auth.refreshTokenTTL {
+		logger.PrintFatal(errors.New("the lifetime of authentication tokens must be positive and must not exceed the lifetime of refresh tokens"), nil)
+	}
+
+	var signer *jwt.Signer
+	if cfg.auth.jwtKeys != "" {
+		keys, err := jwt.ParseKeys(cfg.auth.jwtKeys)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		signer, err = jwt.NewSigner(keys)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		if cfg.auth.revocationRefresh <= 0 {
+			logger.PrintFatal(errors.New("the interval between reloads of the revoked sessions must be positive"), nil)
+		}
+	} else if cfg.auth.tokenMode == tokenModeJWT {
+		logger.PrintFatal(errors.New("signed authentication tokens need at least one signing key"), nil)
+	}
+
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -111,13 +269,42 @@ func main() {
 		return time.Now().Unix()
 	}))
 
+	var rateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.limiter.store == "postgres" {
+		rateLimitStore = ratelimit.NewPostgresStore(db)
+	}
+
+	models := data.NewModels(db)
+
+	// The revoked sessions have to be known before the first signed token is accepted
+	revoked := &revokedSessions{}
+	if signer != nil {
+		sessions, err := models.Tokens.GetAllRevokedSessions()
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		revoked.replace(sessions)
+	}
+
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:   cfg,
+		logger:   logger,
+		models:   models,
+		mailer:   mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		shutdown: make(chan struct{}),
+
+		textPasswordAttempts: newAttemptLimiter(cfg.textPassword.maxAttempts, cfg.textPassword.window),
+		rateLimitStore:       rateLimitStore,
+		limiter:              ratelimit.New(rateLimitStore, cfg.limiter.rps, cfg.limiter.burst),
+		strictLimiter:        ratelimit.New(rateLimitStore, cfg.limiter.strict.rps, cfg.limiter.strict.burst),
+		signer:               signer,
+		revokedSessions:      revoked,
 	}
 
+	app.startExpirySweeper()
+	app.startRateLimiterCleanup()
+	app.startRevokedSessionsRefresh()
+
 	err = app.serve()
 	if err != nil {
 		app.logger.PrintFatal(err, nil)
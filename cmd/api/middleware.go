@@ -62,35 +62,108 @@ func (app *application) metrics(next http.Handler) http.Handler {
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
+		w.Header().Add("Vary", "Cookie")
 
 		authorizationHeader := r.Header.Get("Authorization")
 
-		if authorizationHeader == "" {
-			r = app.contextSetUser(r, data.AnonymousUser)
+		var token string
+		fromCookie := false
+
+		if authorizationHeader != "" {
+			headerParts := strings.Split(authorizationHeader, " ")
+			if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+				app.failedAuthenticationResponse(w, r)
+				return
+			}
+
+			token = headerParts[1]
+		} else {
+			// Browser clients send their authentication token in the session cookie instead of the header
+			cookie, err := r.Cookie(sessionCookieName)
+			if err != nil {
+				r = app.contextSetUser(r, data.AnonymousUser)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token = cookie.Value
+			fromCookie = true
+		}
+
+		// A session cookie that is no longer valid, such as one left behind by an expired or revoked
+		// session, is removed and the request carries on as an anonymous one
+		fail := func() {
+			if !fromCookie {
+				app.failedAuthenticationResponse(w, r)
+				return
+			}
+			if !app.countFailedAuthentication(w, r) {
+				return
+			}
+
+			app.clearSessionCookies(w)
+			next.ServeHTTP(w, app.contextSetUser(r, data.AnonymousUser))
+		}
+
+		// The browser sends the session cookie along with requests started by any site, so requests that
+		// change anything have to prove they come from the client by echoing the CSRF token
+		serve := func(r *http.Request) {
+			if fromCookie && !isSafeMethod(r.Method) && !app.validCSRFToken(r) {
+				app.invalidCSRFTokenResponse(w, r)
+				return
+			}
+
 			next.ServeHTTP(w, r)
-			return
 		}
 
-		headerParts := strings.Split(authorizationHeader, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			app.invalidAuthenticationTokenResponse(w, r)
+		// API keys are told apart from authentication tokens by their prefix
+		if strings.HasPrefix(token, data.APIKeyPrefix) {
+			user, key, err := app.models.APIKeys.GetForKey(token)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					fail()
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetAPIKey(r, key)
+
+			serve(r)
 			return
 		}
 
-		token := headerParts[1]
+		// Signed tokens are told apart from opaque ones by the dots between their parts
+		if app.signer != nil && strings.Contains(token, ".") {
+			user, sessionID, permissions, err := app.verifySignedToken(token)
+			if err != nil {
+				fail()
+				return
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetSession(r, sessionID)
+			r = app.contextSetPermissions(r, permissions)
+
+			serve(r)
+			return
+		}
 
 		v := validator.New()
 
 		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
-			app.invalidAuthenticationTokenResponse(w, r)
+			fail()
 			return
 		}
 
-		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		user, sessionID, err := app.models.Users.GetForSession(token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
-				app.invalidAuthenticationTokenResponse(w, r)
+				fail()
 			default:
 				app.serverErrorResponse(w, r, err)
 			}
@@ -98,23 +171,176 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		r = app.contextSetUser(r, user)
+		r = app.contextSetSession(r, sessionID)
+
+		serve(r)
+	})
+}
+
+// failedAuthenticationResponse counts a request with wrong credentials against the IP address it was
+// made from, and writes the error response. Guessing credentials is limited by the bucket of the IP
+// address, while requests with valid credentials are only counted against their user.
+func (app *application) failedAuthenticationResponse(w http.ResponseWriter, r *http.Request) {
+	if !app.countFailedAuthentication(w, r) {
+		return
+	}
+
+	app.invalidAuthenticationTokenResponse(w, r)
+}
+
+// countFailedAuthentication takes a request with wrong credentials from the bucket of the IP address it
+// was made from, and writes the error response when the IP address has run out of attempts
+func (app *application) countFailedAuthentication(w http.ResponseWriter, r *http.Request) bool {
+	return !app.config.limiter.enabled || app.allowRequest(w, r, app.strictLimiter, "failed-auth ip:"+app.clientIP(r))
+}
+
+// rateLimit limits the requests of each client to the configured rate: anonymous requests by their IP
+// address, and authenticated ones by their user, wherever they are made from.
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.config.limiter.enabled && !app.allowRequest(w, r, app.limiter, app.rateLimitKey(r)) {
+			return
+		}
 
 		next.ServeHTTP(w, r)
 	})
 }
 
-func (app *application) enableCORS(next http.Handler) http.Handler {
+// strictRateLimit applies the stricter limits to routes that are costly or attractive to abuse, such
+// as authentication. Each route has a bucket of its own per client.
+func (app *application) strictRateLimit(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		if app.config.limiter.enabled && !app.allowRequest(w, r, app.strictLimiter, r.Method+" "+r.URL.Path+" "+app.rateLimitKey(r)) {
+			return
+		}
 
-		// Handle preflight request
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireScope checks that requests made with an API key are allowed the scope. Requests made
+// otherwise are let through unchecked.
+func (app *application) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := app.contextGetAPIKey(r)
+		if key == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !key.HasScope(scope) {
+			app.missingScopeResponse(w, r, scope)
 			return
 		}
 
+		next.ServeHTTP(w, app.contextSetScoped(r))
+	})
+}
+
+// requireAuthenticatedUser checks that the user is not anonymous. API keys are only accepted on
+// routes that have a scope, so a key can't be used to manage the account it belongs to.
+func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+
+		if app.contextGetAPIKey(r) != nil && !app.contextIsScoped(r) {
+			app.apiKeyNotAllowedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireActivatedUser checks that the user is both authenticated and activated
+func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if !user.Activated {
+			app.inactiveAccountResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return app.requireAuthenticatedUser(fn)
+}
+
+// requirePermissionOrAnonymous lets anonymous users through, for routes open to them such as creating texts
+// or changing them with their edit secret, but checks that authenticated users have the permission code
+func (app *application) requirePermissionOrAnonymous(code string, next http.HandlerFunc) http.HandlerFunc {
+	withPermission := app.requirePermission(code, next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetUser(r).IsAnonymous() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		withPermission.ServeHTTP(w, r)
+	})
+}
+
+// requirePermission checks that the user is activated and has been granted the permission code.
+// Requests made with an API key also need the scope of the same name.
+func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		permissions, err := app.userPermissions(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include(code) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireScope(code, app.requireActivatedUser(fn))
+}
+
+// enableCORS allows the trusted origins to make cross-origin requests, including credentialed ones so that
+// browser clients can use their session cookies. Requests from other origins get no CORS headers, so
+// browsers don't let pages on them read the responses.
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+
+		if origin != "" {
+			for _, trustedOrigin := range app.config.cors.trustedOrigins {
+				if origin != trustedOrigin {
+					continue
+				}
+
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				w.Header().Set("Access-Control-Expose-Headers", "X-Edit-Secret, Retry-After")
+
+				// Handle preflight request
+				if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+					w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+					w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token, X-Edit-Secret, X-Text-Password, X-Text-Access-Token")
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+
+				break
+			}
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
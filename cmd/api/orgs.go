@@ -0,0 +1,422 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"dev.theenthusiast.text-bin/internal/data"
+	"dev.theenthusiast.text-bin/internal/validator"
+)
+
+// orgInvitationTTL is how long an invitation to join an organization can be accepted
+const orgInvitationTTL = 7 * 24 * time.Hour
+
+// createOrgHandler will be used to create an organization, with the user as its first owner
+func (app *application) createOrgHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	org := &data.Org{Name: input.Name}
+
+	v := validator.New()
+	if data.ValidateOrg(v, org); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Orgs.Insert(org, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"org": org}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listOrgsHandler will be used to list the organizations the user is a member of
+func (app *application) listOrgsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	orgs, err := app.models.Orgs.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"orgs": orgs}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showOrgHandler will be used to show an organization to one of its members
+func (app *application) showOrgHandler(w http.ResponseWriter, r *http.Request) {
+	org, _, ok := app.orgForUser(w, r, data.RoleViewer)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"org": org}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateOrgHandler will be used by owners and admins to rename an organization
+func (app *application) updateOrgHandler(w http.ResponseWriter, r *http.Request) {
+	org, _, ok := app.orgForUser(w, r, data.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name *string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		org.Name = *input.Name
+	}
+
+	v := validator.New()
+	if data.ValidateOrg(v, org); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Orgs.Update(org)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"org": org}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteOrgHandler will be used by owners to delete an organization along with all of its texts
+func (app *application) deleteOrgHandler(w http.ResponseWriter, r *http.Request) {
+	org, _, ok := app.orgForUser(w, r, data.RoleOwner)
+	if !ok {
+		return
+	}
+
+	err := app.models.Orgs.Delete(org.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "organization successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listOrgMembersHandler will be used to list the members of an organization
+func (app *application) listOrgMembersHandler(w http.ResponseWriter, r *http.Request) {
+	org, _, ok := app.orgForUser(w, r, data.RoleViewer)
+	if !ok {
+		return
+	}
+
+	members, err := app.models.Orgs.GetMembers(org.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateOrgMemberHandler will be used by owners and admins to change the role of a member.
+// Only owners can make someone an owner or change the role of another owner.
+func (app *application) updateOrgMemberHandler(w http.ResponseWriter, r *http.Request) {
+	org, _, ok := app.orgForUser(w, r, data.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	member, ok := app.orgMember(w, r, org)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateRole(v, input.Role); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if (member.Role == data.RoleOwner || input.Role == data.RoleOwner) && org.Role != data.RoleOwner {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Orgs.SetMemberRole(org.ID, member.UserID, input.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrLastOwner):
+			app.lastOwnerResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	member.Role = input.Role
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// removeOrgMemberHandler will be used by owners and admins to remove a member, and by any member
+// to leave the organization. Only owners can remove another owner.
+func (app *application) removeOrgMemberHandler(w http.ResponseWriter, r *http.Request) {
+	org, user, ok := app.orgForUser(w, r, data.RoleViewer)
+	if !ok {
+		return
+	}
+
+	member, ok := app.orgMember(w, r, org)
+	if !ok {
+		return
+	}
+
+	leaving := member.UserID == user.ID
+	if !leaving && !data.RoleAtLeast(org.Role, data.RoleAdmin) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	if !leaving && member.Role == data.RoleOwner && org.Role != data.RoleOwner {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err := app.models.Orgs.RemoveMember(org.ID, member.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrLastOwner):
+			app.lastOwnerResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "member successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createOrgInvitationHandler will be used by owners and admins to invite someone to the organization
+// by email. The invitation token is only sent in the email, so that it reaches the invited person.
+func (app *application) createOrgInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	org, user, ok := app.orgForUser(w, r, data.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Role == "" {
+		input.Role = data.RoleMember
+	}
+
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	if data.ValidateRole(v, input.Role); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.Role == data.RoleOwner && org.Role != data.RoleOwner {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	invitation, err := app.models.Orgs.NewInvitation(org.ID, input.Email, input.Role, user.ID, orgInvitationTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		data := map[string]interface{}{
+			"orgID":           org.ID,
+			"orgName":         org.Name,
+			"role":            invitation.Role,
+			"inviterName":     user.Name,
+			"invitationToken": invitation.Plaintext,
+		}
+
+		err := app.mailer.Send(invitation.Email, "org_invitation.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"invitation": invitation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// acceptOrgInvitationHandler will be used to join an organization with an invitation token. The
+// invitation must have been sent to the email address of the user's account.
+func (app *application) acceptOrgInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	orgID, err := app.readIntParam(r, "id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	org, err := app.models.Orgs.AcceptInvitation(orgID, input.TokenPlaintext, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired invitation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrAlreadyMember):
+			v.AddError("token", "you are already a member of this organization")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"org": org}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// orgForUser fetches the organization named in the URL for an authenticated member with at least
+// the given role, and writes the error response otherwise. Organizations are not found for users
+// who aren't members of them.
+func (app *application) orgForUser(w http.ResponseWriter, r *http.Request, minimumRole string) (*data.Org, *data.User, bool) {
+	orgID, err := app.readIntParam(r, "id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil, false
+	}
+
+	user := app.contextGetUser(r)
+
+	org, err := app.models.Orgs.GetForUser(orgID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	if !data.RoleAtLeast(org.Role, minimumRole) {
+		app.notPermittedResponse(w, r)
+		return nil, nil, false
+	}
+
+	return org, user, true
+}
+
+// orgMember fetches the member of the organization named by the userID URL parameter
+func (app *application) orgMember(w http.ResponseWriter, r *http.Request, org *data.Org) (*data.OrgMember, bool) {
+	userID, err := app.readIntParam(r, "userID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	member, err := app.models.Orgs.GetMember(org.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return member, true
+}
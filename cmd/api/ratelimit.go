@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"dev.theenthusiast.text-bin/internal/ratelimit"
+)
+
+// rateLimiterCleanupInterval is how often buckets of clients that have gone quiet are removed
+const rateLimiterCleanupInterval = time.Minute
+
+// rateLimitKey identifies the client a request is counted against: the user when authenticated,
+// and the IP address otherwise.
+func (app *application) rateLimitKey(r *http.Request) string {
+	user := app.contextGetUser(r)
+	if !user.IsAnonymous() {
+		return fmt.Sprintf("user:%d", user.ID)
+	}
+
+	return "ip:" + app.clientIP(r)
+}
+
+// allowRequest takes a request from the bucket of the key, and writes the error response when the
+// request isn't allowed
+func (app *application) allowRequest(w http.ResponseWriter, r *http.Request, limiter *ratelimit.Limiter, key string) bool {
+	retryAfter, ok, err := limiter.Allow(r.Context(), key)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if !ok {
+		app.rateLimitExceededResponse(w, r, retryAfter)
+		return false
+	}
+
+	return true
+}
+
+// startRateLimiterCleanup launches the background worker that removes stale buckets from the rate
+// limit store. The worker is tracked by app.wg and stops once app.shutdown is closed.
+func (app *application) startRateLimiterCleanup() {
+	if !app.config.limiter.enabled {
+		return
+	}
+
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(rateLimiterCleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				err := app.rateLimitStore.Cleanup(context.Background())
+				if err != nil {
+					app.logger.PrintError(err, map[string]string{"task": "clean up rate limit buckets"})
+				}
+			case <-app.shutdown:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"dev.theenthusiast.text-bin/internal/data"
+)
+
+// formatExtensions maps text formats to the file extension used for downloads
+var formatExtensions = map[string]string{
+	"plaintext":  "txt",
+	"markdown":   "md",
+	"go":         "go",
+	"python":     "py",
+	"javascript": "js",
+	"typescript": "ts",
+	"java":       "java",
+	"c":          "c",
+	"cpp":        "cpp",
+	"csharp":     "cs",
+	"rust":       "rs",
+	"ruby":       "rb",
+	"php":        "php",
+	"shell":      "sh",
+	"bash":       "sh",
+	"sql":        "sql",
+	"html":       "html",
+	"css":        "css",
+	"json":       "json",
+	"yaml":       "yaml",
+	"xml":        "xml",
+}
+
+var filenameRX = regexp.MustCompile(`[^a-z0-9]+`)
+
+// rawTextHandler will be used to serve only the content of a text as plain text, so it can be
+// piped straight into other tools. Access rules are the same as for showTextHandler, including
+// password protection and burn after read texts being deleted once shown.
+func (app *application) rawTextHandler(w http.ResponseWriter, r *http.Request) {
+	// The handler is registered both as /raw/:slug and /v1/texts/:id/raw
+	slug, err := app.readSlugParam(r)
+	if err != nil {
+		slug, err = app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+	}
+
+	text, ok := app.readText(w, r, slug)
+	if !ok {
+		return
+	}
+
+	app.writeRaw(w, r, text)
+}
+
+// writeRaw writes the content of the text as text/plain. http.ServeContent takes care of
+// conditional requests (If-None-Match, If-Modified-Since) and byte ranges for us.
+func (app *application) writeRaw(w http.ResponseWriter, r *http.Request, text *data.Text) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if download := r.URL.Query().Get("download"); download != "" && download != "0" && download != "false" {
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": rawFilename(text)})
+		w.Header().Set("Content-Disposition", disposition)
+	}
+
+	// The response depends on the password or access token sent along, and only texts anyone may read
+	// can be kept by shared caches
+	w.Header().Add("Vary", "X-Text-Password")
+	w.Header().Add("Vary", "X-Text-Access-Token")
+	if text.Visibility != data.VisibilityPublic || text.PasswordProtected || text.BurnAfterRead {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+
+	// A burn after read text may already be gone, so it must be sent in full.
+	// Answering a conditional or range request here would lose the content for good.
+	if text.BurnAfterRead {
+		err := app.writePlainText(w, http.StatusOK, text.Content, nil)
+		if err != nil {
+			app.logError(r, err)
+		}
+		return
+	}
+
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%d"`, text.Slug, text.Version))
+
+	http.ServeContent(w, r, "", text.CreatedAt, strings.NewReader(text.Content))
+}
+
+// rawFilename builds a download filename from the title and format of the text,
+// falling back to the slug when the title has no usable characters.
+func rawFilename(text *data.Text) string {
+	name := strings.Trim(filenameRX.ReplaceAllString(strings.ToLower(text.Title), "-"), "-")
+	if len(name) > 50 {
+		name = strings.TrimRight(name[:50], "-")
+	}
+	if name == "" {
+		name = text.Slug
+	}
+
+	ext, ok := formatExtensions[strings.ToLower(text.Format)]
+	if !ok {
+		ext = "txt"
+	}
+
+	return name + "." + ext
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"dev.theenthusiast.text-bin/internal/data"
+	"dev.theenthusiast.text-bin/internal/validator"
+)
+
+// listTextRevisionsHandler will be used to list the revision history of a text
+func (app *application) listTextRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	slug, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	var userID *int64
+	if !user.IsAnonymous() {
+		userID = &user.ID
+	}
+
+	text, err := app.models.Texts.Get(slug, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	revisions, err := app.models.Revisions.GetAllForText(text.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revisions": revisions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showTextRevisionHandler will be used to show the content of a text at a specific version
+func (app *application) showTextRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	slug, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	version, err := app.readIntParam(r, "version")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	var userID *int64
+	if !user.IsAnonymous() {
+		userID = &user.ID
+	}
+
+	text, err := app.models.Texts.Get(slug, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	revision, err := app.models.Revisions.Get(text.ID, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revision": revision}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreTextRevisionHandler will be used to restore an older version of a text. The restored
+// content is saved through the regular update path, so it becomes a new revision.
+func (app *application) restoreTextRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	slug, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	version, err := app.readIntParam(r, "version")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	var userID *int64
+	if !user.IsAnonymous() {
+		userID = &user.ID
+	}
+	editSecret := r.Header.Get(editSecretHeader)
+
+	text, err := app.models.Texts.GetWithEditSecret(slug, userID, editSecret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !text.EditableBy(userID, editSecret) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	revision, err := app.models.Revisions.Get(text.ID, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	text.Title = revision.Title
+	text.Content = revision.Content
+	text.Format = revision.Format
+
+	v := validator.New()
+	if data.ValidateText(v, text, app.expiryPolicy(user)); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Texts.Update(text, userID, editSecret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"text": text}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"expvar"
 	"net/http"
 
+	"dev.theenthusiast.text-bin/internal/data"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -22,30 +23,71 @@ func (app *application) routes() http.Handler {
 	// register the healthcheck handler function with the router
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthCheckHandler)
 
-	router.HandlerFunc(http.MethodPost, "/v1/texts", app.createTextHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/texts/:id", app.showTextHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/texts/:id", app.updateTextHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/texts/:id", app.deleteTextHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/texts", app.requireScope(data.APIKeyScopeTextsRead, app.listTextsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/texts", app.strictRateLimit(app.requirePermissionOrAnonymous(data.PermissionTextsWrite, app.createTextHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/texts/:id", app.requireScope(data.APIKeyScopeTextsRead, app.showTextHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/texts/:id", app.requirePermissionOrAnonymous(data.PermissionTextsWrite, app.updateTextHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/texts/:id", app.requirePermissionOrAnonymous(data.PermissionTextsWrite, app.deleteTextHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/texts/:id/raw", app.requireScope(data.APIKeyScopeTextsRead, app.rawTextHandler))
+	router.HandlerFunc(http.MethodGet, "/raw/:slug", app.requireScope(data.APIKeyScopeTextsRead, app.rawTextHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/texts/:id/access", app.requireScope(data.APIKeyScopeTextsRead, app.createTextAccessTokenHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/search", app.requireScope(data.APIKeyScopeTextsRead, app.searchTextsHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users/email", app.getCurrentUser)
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/users/:id", app.deleteAccountHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/users/:id", app.requireAuthenticatedUser(app.deleteAccountHandler))
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
 
-	router.HandlerFunc(http.MethodPost, "/v1/users/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users/authentication", app.strictRateLimit(app.createAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.strictRateLimit(app.refreshAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.requireAuthenticatedUser(app.deleteAuthenticationTokenHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/api-keys", app.requireAuthenticatedUser(app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/api-keys", app.requireActivatedUser(app.createAPIKeyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/api-keys/:id", app.requireAuthenticatedUser(app.revokeAPIKeyHandler))
 
-	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/sessions", app.requireAuthenticatedUser(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/sessions", app.requireAuthenticatedUser(app.revokeOtherSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/sessions/:id", app.requireAuthenticatedUser(app.revokeSessionHandler))
+
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.strictRateLimit(app.updateUserPasswordHandler))
 
 	// Add the POST /v1/tokens/password-reset endpoint.
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.strictRateLimit(app.createPasswordResetTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.strictRateLimit(app.createActivationTokenHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/texts/:id/like", app.requireActivatedUser(app.addLikeHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/texts/:id/like", app.requireActivatedUser(app.removeLikeHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/texts/:id/comments", app.requirePermission(data.PermissionCommentsWrite, app.addCommentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/texts/:id/comments/:commentID", app.requirePermission(data.PermissionCommentsWrite, app.deleteCommentHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/texts/:id/revisions", app.requireScope(data.APIKeyScopeTextsRead, app.listTextRevisionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/texts/:id/revisions/:version", app.requireScope(data.APIKeyScopeTextsRead, app.showTextRevisionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/texts/:id/revisions/:version/restore", app.requirePermissionOrAnonymous(data.PermissionTextsWrite, app.restoreTextRevisionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/texts/:id/diff", app.requireScope(data.APIKeyScopeTextsRead, app.diffTextHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/texts/:id/shares", app.requireAuthenticatedUser(app.listTextSharesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/texts/:id/shares", app.requirePermission(data.PermissionTextsWrite, app.grantTextShareHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/texts/:id/shares/:email", app.requirePermission(data.PermissionTextsWrite, app.revokeTextShareHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/texts/:id/links", app.requireAuthenticatedUser(app.listShareLinksHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/texts/:id/links", app.requirePermission(data.PermissionTextsWrite, app.createShareLinkHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/texts/:id/links/:linkID", app.requirePermission(data.PermissionTextsWrite, app.revokeShareLinkHandler))
 
-	router.HandlerFunc(http.MethodPost, "/v1/texts/:id/like", app.addLikeHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/texts/:id/like", app.removeLikeHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/texts/:id/comments", app.addCommentHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/texts/:id/comments/:commentID", app.deleteCommentHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/orgs", app.requireAuthenticatedUser(app.listOrgsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/orgs", app.requireActivatedUser(app.createOrgHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:id", app.requireAuthenticatedUser(app.showOrgHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/orgs/:id", app.requireActivatedUser(app.updateOrgHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/orgs/:id", app.requireActivatedUser(app.deleteOrgHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:id/members", app.requireAuthenticatedUser(app.listOrgMembersHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/orgs/:id/members/:userID", app.requireActivatedUser(app.updateOrgMemberHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/orgs/:id/members/:userID", app.requireAuthenticatedUser(app.removeOrgMemberHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/orgs/:id/invitations", app.requireActivatedUser(app.createOrgInvitationHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/orgs/:id/invitations/accepted", app.requireActivatedUser(app.acceptOrgInvitationHandler))
 
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
 	// return the router
-	return app.enableCORS((app.metrics(app.recoverPanic(app.authenticate(router)))))
+	return app.enableCORS((app.metrics(app.recoverPanic(app.authenticate(app.rateLimit(router))))))
 }
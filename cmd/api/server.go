@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -19,6 +20,27 @@ func (app *application) serve() error {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
 	}
+
+	// Start the optional TCP paste listener alongside the HTTP server
+	var tcpListener net.Listener
+	if app.config.tcp.port > 0 {
+		var err error
+		tcpListener, err = net.Listen("tcp", fmt.Sprintf(":%d", app.config.tcp.port))
+		if err != nil {
+			return err
+		}
+
+		app.wg.Add(1)
+		go func() {
+			defer app.wg.Done()
+			app.serveTCP(tcpListener)
+		}()
+
+		app.logger.PrintInfo("Starting TCP paste listener", map[string]string{
+			"addr": tcpListener.Addr().String(),
+		})
+	}
+
 	shutdownError := make(chan error)
 
 	go func() {
@@ -37,6 +59,15 @@ func (app *application) serve() error {
 			shutdownError <- err
 		}
 
+		// Tell the background workers to stop
+		close(app.shutdown)
+
+		// Stop accepting new pastes over TCP. Connections already being handled are
+		// tracked by app.wg and complete before we return.
+		if tcpListener != nil {
+			tcpListener.Close()
+		}
+
 		app.logger.PrintInfo("completing background tasks", map[string]string{
 			"addr": srv.Addr,
 		})
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"dev.theenthusiast.text-bin/internal/data"
+)
+
+// listSessionsHandler will be used to list the sessions of the user, that is the authentication
+// tokens that haven't expired yet, with the one the request was made with marked as current
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	sessions, err := app.models.Tokens.GetAllSessionsForUser(user.ID, app.contextGetSession(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeSessionHandler will be used to log the user out of one of their sessions
+func (app *application) revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := app.readIntParam(r, "id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Tokens.DeleteSession(sessionID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.loadRevokedSessions()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeOtherSessionsHandler will be used to log the user out everywhere but the current session
+func (app *application) revokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	revoked, err := app.models.Tokens.DeleteOtherSessions(user.ID, app.contextGetSession(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.loadRevokedSessions()
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": fmt.Sprintf("%d sessions successfully revoked", revoked)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAuthenticationTokenHandler will be used to log out, revoking the authentication token the request was made with.
+// The cookies of browser clients are removed as well.
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.models.Tokens.DeleteSession(app.contextGetSession(r), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.loadRevokedSessions()
+
+	if _, err := r.Cookie(sessionCookieName); err == nil {
+		app.clearSessionCookies(w)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "successfully logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"dev.theenthusiast.text-bin/internal/data"
+	"dev.theenthusiast.text-bin/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// listTextSharesHandler will be used to list the users a text is shared with. Only the owner of the text can see them.
+func (app *application) listTextSharesHandler(w http.ResponseWriter, r *http.Request) {
+	text, ok := app.ownedText(w, r)
+	if !ok {
+		return
+	}
+
+	shares, err := app.models.Shares.GetAllForText(text.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"shares": shares}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// grantTextShareHandler will be used to share a text with another user by their email address.
+// Sharing it again with the same user changes the permission of the existing share.
+func (app *application) grantTextShareHandler(w http.ResponseWriter, r *http.Request) {
+	text, ok := app.ownedText(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Email      string `json:"email"`
+		Permission string `json:"permission"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	share := &data.Share{
+		TextID:     text.ID,
+		Email:      input.Email,
+		Permission: input.Permission,
+	}
+
+	v := validator.New()
+	v.Check(share.Email != app.contextGetUser(r).Email, "email", "must not be your own email address")
+	if data.ValidateShare(v, share); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Shares.Grant(share)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no matching user account found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"share": share}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeTextShareHandler will be used to stop sharing a text with the user that has the email address
+func (app *application) revokeTextShareHandler(w http.ResponseWriter, r *http.Request) {
+	text, ok := app.ownedText(w, r)
+	if !ok {
+		return
+	}
+
+	email := httprouter.ParamsFromContext(r.Context()).ByName("email")
+
+	err := app.models.Shares.Revoke(text.ID, email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "share successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ownedText fetches the text named in the URL for a handler that only its owner may use, or the owners
+// and admins of its organization, and writes the error response when the user doesn't manage the text.
+func (app *application) ownedText(w http.ResponseWriter, r *http.Request) (*data.Text, bool) {
+	slug, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user := app.contextGetUser(r)
+
+	text, err := app.models.Texts.Get(slug, &user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if !text.ManagedBy(&user.ID) {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return text, true
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"expvar"
+	"fmt"
+	"time"
+)
+
+// startExpirySweeper launches the background worker that purges expired texts and tokens every
+// sweeper interval. The worker is tracked by app.wg and stops once app.shutdown is closed.
+func (app *application) startExpirySweeper() {
+	if app.config.sweeper.interval <= 0 {
+		return
+	}
+
+	stats := expvar.NewMap("expiry_sweeper")
+
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.sweeper.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				app.sweepExpired(stats)
+			case <-app.shutdown:
+				return
+			}
+		}
+	}()
+}
+
+// sweepExpired deletes expired texts in batches, so a large backlog never holds locks on the
+// texts table for long, and then removes all expired tokens and the burned texts past their retention.
+func (app *application) sweepExpired(stats *expvar.Map) {
+	defer func() {
+		if err := recover(); err != nil {
+			stats.Add("errors", 1)
+			app.logger.PrintError(fmt.Errorf("%s", err), nil)
+		}
+	}()
+
+	stats.Add("runs", 1)
+
+	var textsDeleted int64
+	for {
+		n, err := app.models.Texts.DeleteExpired(app.config.sweeper.batchSize)
+		if err != nil {
+			stats.Add("errors", 1)
+			app.logger.PrintError(err, map[string]string{"task": "delete expired texts"})
+			break
+		}
+		textsDeleted += n
+		stats.Add("texts_deleted", n)
+
+		if n < int64(app.config.sweeper.batchSize) {
+			break
+		}
+
+		// Stop between batches if the server is shutting down
+		select {
+		case <-app.shutdown:
+			return
+		default:
+		}
+	}
+
+	tokensDeleted, err := app.models.Tokens.DeleteExpired()
+	if err != nil {
+		stats.Add("errors", 1)
+		app.logger.PrintError(err, map[string]string{"task": "delete expired tokens"})
+	}
+	stats.Add("tokens_deleted", tokensDeleted)
+
+	burnedDeleted, err := app.models.Texts.DeleteBurnedBefore(time.Now().Add(-app.config.sweeper.burnedRetention))
+	if err != nil {
+		stats.Add("errors", 1)
+		app.logger.PrintError(err, map[string]string{"task": "delete burned texts"})
+	}
+	stats.Add("burned_texts_deleted", burnedDeleted)
+
+	if textsDeleted > 0 || tokensDeleted > 0 || burnedDeleted > 0 {
+		app.logger.PrintInfo("purged expired records", map[string]string{
+			"texts":        fmt.Sprintf("%d", textsDeleted),
+			"tokens":       fmt.Sprintf("%d", tokensDeleted),
+			"burned_texts": fmt.Sprintf("%d", burnedDeleted),
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"dev.theenthusiast.text-bin/internal/data"
+	"dev.theenthusiast.text-bin/internal/validator"
+)
+
+// tcpMaxConnDuration is the longest a single connection to the TCP paste listener may stay open,
+// however slowly the client keeps sending data.
+const tcpMaxConnDuration = 30 * time.Second
+
+// tcpMaxBytes is the largest paste accepted over TCP, the same content limit that ValidateText enforces
+const tcpMaxBytes = 1_000_000
+
+// serveTCP accepts connections on the termbin-style paste listener until the listener is closed.
+// Every connection is handled in its own goroutine, tracked by app.wg so that a graceful shutdown
+// waits for pastes that are still being stored. Connections beyond the configured maximum are
+// turned away rather than left waiting, as each one may be held open for tcpMaxConnDuration.
+func (app *application) serveTCP(ln net.Listener) {
+	sem := make(chan struct{}, app.config.tcp.maxConns)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			app.logger.PrintError(err, map[string]string{"addr": ln.Addr().String()})
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		default:
+			conn.SetWriteDeadline(time.Now().Add(time.Second))
+			fmt.Fprintln(conn, "error: too many connections, please try again later")
+			conn.Close()
+			continue
+		}
+
+		app.wg.Add(1)
+		go func() {
+			defer app.wg.Done()
+			defer func() { <-sem }()
+			defer conn.Close()
+
+			defer func() {
+				if err := recover(); err != nil {
+					app.logger.PrintError(fmt.Errorf("%s", err), nil)
+				}
+			}()
+
+			app.handleTCPConn(conn)
+		}()
+	}
+}
+
+// handleTCPConn reads a paste from the connection until the client closes its side, stops sending
+// for the configured read timeout, or the size limit is exceeded. The paste is stored as an anonymous
+// plaintext text with the configured visibility, unlisted by default, as pastes piped from a shell are
+// rarely meant to be listed. The URL of its raw content is written back before the connection is
+// closed, followed by the edit secret that lets the client update or delete it on a line of its own.
+// Pastes count against the strict rate limit of the IP address of the client.
+func (app *application) handleTCPConn(conn net.Conn) {
+	if app.config.limiter.enabled {
+		host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+		if err != nil {
+			host = conn.RemoteAddr().String()
+		}
+
+		retryAfter, ok, err := app.strictLimiter.Allow(context.Background(), "tcp ip:"+host)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"remote_addr": conn.RemoteAddr().String()})
+			fmt.Fprintln(conn, "error: the server encountered a problem and could not store your paste")
+			return
+		}
+		if !ok {
+			fmt.Fprintf(conn, "error: rate limit exceeded, retry in %d seconds\n", int(math.Ceil(retryAfter.Seconds())))
+			return
+		}
+	}
+
+	content, err := app.readTCPPaste(conn)
+	if err != nil {
+		fmt.Fprintf(conn, "error: %s\n", err)
+		return
+	}
+
+	text := &data.Text{
+		Title:      "Untitled",
+		Content:    content,
+		Format:     "plaintext",
+		Visibility: app.config.tcp.visibility,
+	}
+	if app.config.tcp.expiry > 0 {
+		expires := time.Now().Add(app.config.tcp.expiry)
+		text.Expires = &expires
+	}
+
+	slug, err := app.models.Texts.GenerateUniqueSlug(text.Title)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"remote_addr": conn.RemoteAddr().String()})
+		fmt.Fprintln(conn, "error: the server encountered a problem and could not store your paste")
+		return
+	}
+	text.Slug = slug
+
+	err = text.SetEditSecret()
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"remote_addr": conn.RemoteAddr().String()})
+		fmt.Fprintln(conn, "error: the server encountered a problem and could not store your paste")
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateText(v, text, app.expiryPolicy(data.AnonymousUser)); !v.Valid() {
+		for field, message := range v.Errors {
+			fmt.Fprintf(conn, "error: %s %s\n", field, message)
+		}
+		return
+	}
+
+	err = app.models.Texts.Insert(text)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"remote_addr": conn.RemoteAddr().String()})
+		fmt.Fprintln(conn, "error: the server encountered a problem and could not store your paste")
+		return
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintln(conn, app.rawTextURL(nil, text.Slug))
+	fmt.Fprintf(conn, "edit secret: %s\n", text.EditSecret)
+}
+
+// readTCPPaste reads everything the client sends. Clients such as nc don't always close their side
+// of the connection, so a pause longer than the read timeout also marks the end of the paste.
+func (app *application) readTCPPaste(conn net.Conn) (string, error) {
+	var buf bytes.Buffer
+	chunk := make([]byte, 32*1024)
+	deadline := time.Now().Add(tcpMaxConnDuration)
+
+	for {
+		readDeadline := time.Now().Add(app.config.tcp.readTimeout)
+		if readDeadline.After(deadline) {
+			readDeadline = deadline
+		}
+		conn.SetReadDeadline(readDeadline)
+
+		n, err := conn.Read(chunk)
+		buf.Write(chunk[:n])
+
+		if buf.Len() > tcpMaxBytes {
+			return "", fmt.Errorf("paste must not be more than %d bytes long", tcpMaxBytes)
+		}
+
+		if err != nil {
+			switch {
+			case errors.Is(err, io.EOF):
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				if !time.Now().Before(deadline) {
+					return "", errors.New("timed out while reading the paste")
+				}
+			default:
+				return "", err
+			}
+			break
+		}
+	}
+
+	if strings.TrimSpace(buf.String()) == "" {
+		return "", errors.New("paste must not be empty")
+	}
+	if !utf8.Valid(buf.Bytes()) {
+		return "", errors.New("paste must be valid UTF-8 text")
+	}
+
+	return buf.String(), nil
+}
@@ -3,53 +3,125 @@ package main
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
-	"time"
+	"net/url"
+	"strconv"
 
 	"dev.theenthusiast.text-bin/internal/data"
 	"dev.theenthusiast.text-bin/internal/validator"
 )
 
-// createTextHandler will be used to create a text
+// createTextInput holds the fields accepted when creating a text
+type createTextInput struct {
+	Title          string `json:"title"`
+	Content        string `json:"content"`
+	Format         string `json:"format"`
+	ExpiresValue   int    `json:"expiresValue"`
+	ExpiresUnit    string `json:"expiresUnit"`
+	Visibility     string `json:"visibility"`
+	IsPrivate      *bool  `json:"is_private"`
+	EncryptionSalt string `json:"encryptionSalt"`
+	BurnAfterRead  bool   `json:"burn_after_read"`
+	Password       string `json:"password"`
+	OrgID          *int64 `json:"org_id"`
+}
+
+// createTextHandler will be used to create a text. Besides JSON, it accepts plain text, binary and
+// multipart/form-data bodies so that pastes can be piped in straight from the command line.
 func (app *application) createTextHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Title          string `json:"title"`
-		Content        string `json:"content"`
-		Format         string `json:"format"`
-		ExpiresValue   int    `json:"expiresValue"`
-		ExpiresUnit    string `json:"expiresUnit"`
-		IsPrivate      bool   `json:"is_private"`
-		EncryptionSalt string `json:"encryptionSalt"`
-	}
+	var input createTextInput
 
-	err := app.readJSON(w, r, &input)
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/plain", "application/octet-stream", "multipart/form-data":
+		err = app.readTextForm(w, r, mediaType, &input)
+	default:
+		err = app.readJSON(w, r, &input)
+	}
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	var expires time.Time
-	if input.ExpiresUnit != "" && input.ExpiresValue != 0 {
-		expires, err = app.expirationTime(input.ExpiresValue, input.ExpiresUnit)
-		if err != nil {
-			app.badRequestResponse(w, r, err)
-			return
+	// Old clients send is_private instead of visibility. Texts of an organization are only
+	// visible to its members unless asked otherwise.
+	if input.Visibility == "" {
+		switch {
+		case input.IsPrivate != nil && *input.IsPrivate:
+			input.Visibility = data.VisibilityPrivate
+		case input.OrgID != nil:
+			input.Visibility = data.VisibilityOrg
+		default:
+			input.Visibility = data.VisibilityPublic
 		}
 	}
 
 	user := app.contextGetUser(r)
 
+	expires, err := app.expirationTime(input.ExpiresValue, input.ExpiresUnit, user)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
 	text := &data.Text{
 		Title:          input.Title,
 		Content:        input.Content,
 		Format:         input.Format,
 		Expires:        expires,
-		IsPrivate:      input.IsPrivate,
+		Visibility:     input.Visibility,
 		EncryptionSalt: input.EncryptionSalt,
+		BurnAfterRead:  input.BurnAfterRead,
 	}
 	if !user.IsAnonymous() {
 		text.UserID = &user.ID
 	}
+	// Only members that can write to an organization may create texts for it
+	if input.OrgID != nil {
+		if user.IsAnonymous() {
+			app.authenticationRequiredResponse(w, r)
+			return
+		}
+		org, err := app.models.Orgs.GetForUser(*input.OrgID, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.failedValidationResponse(w, r, map[string]string{"org_id": "must be an organization you are a member of"})
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !data.RoleAtLeast(org.Role, data.RoleMember) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		text.OrgID = &org.ID
+	}
+	// Anonymous texts get a secret so whoever created them can update or delete them later
+	if text.UserID == nil {
+		err = text.SetEditSecret()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	// Anonymous users may protect their texts with a password as well. It is validated before
+	// hashing, as bcrypt rejects passwords longer than 72 bytes.
+	if input.Password != "" {
+		v := validator.New()
+		if data.ValidatePasswordPlaintext(v, input.Password); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+		err = text.SetPassword(input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
 
 	slug, err := app.models.Texts.GenerateUniqueSlug(text.Title)
 	if err != nil {
@@ -59,7 +131,7 @@ func (app *application) createTextHandler(w http.ResponseWriter, r *http.Request
 	text.Slug = slug
 
 	v := validator.New()
-	if data.ValidateText(v, text); !v.Valid() {
+	if data.ValidateText(v, text, app.expiryPolicy(user)); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -72,6 +144,17 @@ func (app *application) createTextHandler(w http.ResponseWriter, r *http.Request
 
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/texts/%s", text.Slug))
+	if text.EditSecret != "" {
+		headers.Set(editSecretHeader, text.EditSecret)
+	}
+
+	if app.prefersPlainText(r) {
+		err = app.writePlainText(w, http.StatusCreated, app.rawTextURL(r, text.Slug)+"\n", headers)
+		if err != nil {
+			app.logError(r, err)
+		}
+		return
+	}
 
 	err = app.writeJSON(w, http.StatusCreated, envelope{"text": text}, headers)
 	if err != nil {
@@ -79,7 +162,80 @@ func (app *application) createTextHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
-// showTextHandler will be used to show a text
+// readTextForm fills the input from a plain text, binary or multipart/form-data body. The fields that are
+// part of the JSON body are read from the query string, or from the form fields for multipart uploads.
+func (app *application) readTextForm(w http.ResponseWriter, r *http.Request, mediaType string, input *createTextInput) error {
+	var form url.Values
+
+	switch mediaType {
+	case "multipart/form-data":
+		content, filename, err := app.readMultipartFile(w, r, "file")
+		if err != nil {
+			return err
+		}
+		// r.Form holds both the query string and the multipart form fields
+		form = r.Form
+		input.Content = content
+		if input.Content == "" {
+			input.Content = form.Get("content")
+		}
+		input.Title = app.readString(form, "title", filename)
+	default:
+		content, err := app.readPlainText(w, r)
+		if err != nil {
+			return err
+		}
+		form = r.URL.Query()
+		input.Content = content
+		input.Title = app.readString(form, "title", "")
+	}
+
+	if input.Title == "" {
+		input.Title = "Untitled"
+	}
+	input.Format = app.readString(form, "format", "plaintext")
+	input.ExpiresUnit = app.readString(form, "expiresUnit", "")
+	input.EncryptionSalt = app.readString(form, "encryptionSalt", "")
+	input.Password = app.readString(form, "password", "")
+	input.Visibility = app.readString(form, "visibility", "")
+
+	if s := form.Get("expiresValue"); s != "" {
+		expiresValue, err := strconv.Atoi(s)
+		if err != nil {
+			return errors.New("expiresValue must be an integer value")
+		}
+		input.ExpiresValue = expiresValue
+	}
+
+	if s := form.Get("is_private"); s != "" {
+		isPrivate, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("is_private must be a boolean value")
+		}
+		input.IsPrivate = &isPrivate
+	}
+
+	if s := form.Get("burn_after_read"); s != "" {
+		burnAfterRead, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("burn_after_read must be a boolean value")
+		}
+		input.BurnAfterRead = burnAfterRead
+	}
+
+	if s := form.Get("org_id"); s != "" {
+		orgID, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return errors.New("org_id must be an integer value")
+		}
+		input.OrgID = &orgID
+	}
+
+	return nil
+}
+
+// showTextHandler will be used to show a text. Password protected texts must be unlocked first,
+// and burn after read texts are deleted once shown.
 func (app *application) showTextHandler(w http.ResponseWriter, r *http.Request) {
 	slug, err := app.readIDParam(r)
 	if err != nil {
@@ -87,24 +243,122 @@ func (app *application) showTextHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	text, ok := app.readText(w, r, slug)
+	if !ok {
+		return
+	}
+
+	var headers http.Header
+	if text.BurnAfterRead {
+		headers = http.Header{"Cache-Control": []string{"no-store"}}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"text": text}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listTextsHandler will be used to list texts with pagination, sorting and filtering. The texts carry a preview
+// of their content, and clients fetch the full content from GET /v1/texts/:id or GET /raw/:slug.
+func (app *application) listTextsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Format  string
+		OwnerID int
+		OrgID   int
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Format = app.readString(qs, "format", "")
+	input.OwnerID = app.readInt(qs, "owner", 0, v)
+	input.OrgID = app.readInt(qs, "org", 0, v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = []string{"created_at", "title", "likes_count", "expires", "-created_at", "-title", "-likes_count", "-expires"}
+
+	v.Check(input.OwnerID >= 0, "owner", "must be a positive integer")
+	v.Check(input.OrgID >= 0, "org", "must be a positive integer")
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var ownerID *int64
+	if input.OwnerID > 0 {
+		id := int64(input.OwnerID)
+		ownerID = &id
+	}
+
+	var orgID *int64
+	if input.OrgID > 0 {
+		id := int64(input.OrgID)
+		orgID = &id
+	}
+
 	user := app.contextGetUser(r)
 	var userID *int64
 	if !user.IsAnonymous() {
 		userID = &user.ID
 	}
 
-	text, err := app.models.Texts.Get(slug, userID)
+	texts, metadata, err := app.models.Texts.GetAll(input.Format, ownerID, orgID, userID, input.Filters)
 	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
-		}
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"text": text}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"texts": texts, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// searchTextsHandler will be used to run a full-text search over the title and content of texts
+func (app *application) searchTextsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query  string
+		Format string
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Query = app.readString(qs, "q", "")
+	input.Format = app.readString(qs, "format", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-rank")
+	input.Filters.SortSafelist = []string{"rank", "created_at", "title", "-rank", "-created_at", "-title"}
+
+	v.Check(input.Query != "", "q", "must be provided")
+	v.Check(len(input.Query) <= 200, "q", "must not be more than 200 bytes long")
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	var userID *int64
+	if !user.IsAnonymous() {
+		userID = &user.ID
+	}
+
+	results, metadata, err := app.models.Texts.Search(input.Query, input.Format, userID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results, "metadata": metadata}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -118,12 +372,13 @@ func (app *application) updateTextHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	user := app.contextGetUser(r)
-	if user.IsAnonymous() {
-		app.authenticationRequiredResponse(w, r)
-		return
+	var userID *int64
+	if !user.IsAnonymous() {
+		userID = &user.ID
 	}
+	editSecret := r.Header.Get(editSecretHeader)
 
-	text, err := app.models.Texts.Get(slug, &user.ID)
+	text, err := app.models.Texts.GetWithEditSecret(slug, userID, editSecret)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -134,13 +389,21 @@ func (app *application) updateTextHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if !text.EditableBy(userID, editSecret) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
 	var input struct {
-		Title        *string `json:"title"`
-		Content      *string `json:"content"`
-		Format       *string `json:"format"`
-		ExpiresUnit  *string `json:"expiresUnit"`
-		ExpiresValue *int    `json:"expiresValue"`
-		IsPrivate    *bool   `json:"is_private"`
+		Title         *string `json:"title"`
+		Content       *string `json:"content"`
+		Format        *string `json:"format"`
+		ExpiresUnit   *string `json:"expiresUnit"`
+		ExpiresValue  *int    `json:"expiresValue"`
+		Visibility    *string `json:"visibility"`
+		IsPrivate     *bool   `json:"is_private"`
+		BurnAfterRead *bool   `json:"burn_after_read"`
+		Password      *string `json:"password"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -149,6 +412,13 @@ func (app *application) updateTextHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Editors may change what the text says, but not who can read it or for how long
+	settingsChanged := input.ExpiresUnit != nil || input.Visibility != nil || input.IsPrivate != nil || input.BurnAfterRead != nil || input.Password != nil
+	if settingsChanged && !text.ManagedBy(userID) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
 	if input.Title != nil {
 		text.Title = *input.Title
 	}
@@ -158,24 +428,55 @@ func (app *application) updateTextHandler(w http.ResponseWriter, r *http.Request
 	if input.Format != nil {
 		text.Format = *input.Format
 	}
-	if input.ExpiresUnit != nil && input.ExpiresValue != nil {
-		text.Expires, err = app.expirationTime(*input.ExpiresValue, *input.ExpiresUnit)
+	if input.ExpiresUnit != nil && (input.ExpiresValue != nil || *input.ExpiresUnit == "never") {
+		var expiresValue int
+		if input.ExpiresValue != nil {
+			expiresValue = *input.ExpiresValue
+		}
+		text.Expires, err = app.expirationTime(expiresValue, *input.ExpiresUnit, user)
 		if err != nil {
 			app.badRequestResponse(w, r, err)
 			return
 		}
 	}
-	if input.IsPrivate != nil {
-		text.IsPrivate = *input.IsPrivate
+	// Old clients send is_private instead of visibility. Making a text not private turns it public,
+	// while an unlisted text stays unlisted.
+	switch {
+	case input.Visibility != nil:
+		text.Visibility = *input.Visibility
+	case input.IsPrivate != nil && *input.IsPrivate:
+		text.Visibility = data.VisibilityPrivate
+	case input.IsPrivate != nil && text.Visibility == data.VisibilityPrivate:
+		text.Visibility = data.VisibilityPublic
+	}
+	if input.BurnAfterRead != nil {
+		text.BurnAfterRead = *input.BurnAfterRead
+	}
+	// An empty password removes the password protection
+	if input.Password != nil {
+		if *input.Password == "" {
+			text.RemovePassword()
+		} else {
+			v := validator.New()
+			if data.ValidatePasswordPlaintext(v, *input.Password); !v.Valid() {
+				app.failedValidationResponse(w, r, v.Errors)
+				return
+			}
+			err = text.SetPassword(*input.Password)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
 	}
 
 	v := validator.New()
-	if data.ValidateText(v, text); !v.Valid() {
+	if data.ValidateText(v, text, app.expiryPolicy(user)); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Texts.Update(text, user.ID)
+	err = app.models.Texts.Update(text, userID, editSecret)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -200,12 +501,29 @@ func (app *application) deleteTextHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	user := app.contextGetUser(r)
-	if user.IsAnonymous() {
-		app.authenticationRequiredResponse(w, r)
+	var userID *int64
+	if !user.IsAnonymous() {
+		userID = &user.ID
+	}
+	editSecret := r.Header.Get(editSecretHeader)
+
+	text, err := app.models.Texts.GetWithEditSecret(slug, userID, editSecret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	err = app.models.Texts.Delete(slug, user.ID)
+	if !text.DeletableBy(userID, editSecret) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Texts.Delete(slug, userID, editSecret)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -224,10 +542,6 @@ func (app *application) deleteTextHandler(w http.ResponseWriter, r *http.Request
 
 func (app *application) addLikeHandler(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
-	if user.IsAnonymous() {
-		app.authenticationRequiredResponse(w, r)
-		return
-	}
 
 	textID, err := app.readIntParam(r, "id")
 	if err != nil {
@@ -235,6 +549,21 @@ func (app *application) addLikeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	burnAfterRead, err := app.models.Texts.IsBurnAfterRead(textID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if burnAfterRead {
+		app.failedValidationResponse(w, r, map[string]string{"text": "burn after read texts cannot be liked"})
+		return
+	}
+
 	err = app.models.Likes.AddLike(user.ID, textID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -249,10 +578,6 @@ func (app *application) addLikeHandler(w http.ResponseWriter, r *http.Request) {
 
 func (app *application) removeLikeHandler(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
-	if user.IsAnonymous() {
-		app.authenticationRequiredResponse(w, r)
-		return
-	}
 
 	textID, err := app.readIntParam(r, "id")
 	if err != nil {
@@ -274,10 +599,6 @@ func (app *application) removeLikeHandler(w http.ResponseWriter, r *http.Request
 
 func (app *application) addCommentHandler(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
-	if user.IsAnonymous() {
-		app.authenticationRequiredResponse(w, r)
-		return
-	}
 
 	textID, err := app.readIntParam(r, "id")
 	if err != nil {
@@ -285,6 +606,21 @@ func (app *application) addCommentHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	burnAfterRead, err := app.models.Texts.IsBurnAfterRead(textID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if burnAfterRead {
+		app.failedValidationResponse(w, r, map[string]string{"text": "burn after read texts cannot be commented on"})
+		return
+	}
+
 	var input struct {
 		Content string `json:"content"`
 	}
@@ -315,10 +651,6 @@ func (app *application) addCommentHandler(w http.ResponseWriter, r *http.Request
 
 func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
-	if user.IsAnonymous() {
-		app.authenticationRequiredResponse(w, r)
-		return
-	}
 
 	commentID, err := app.readIntParam(r, "commentID")
 	if err != nil {
@@ -326,7 +658,23 @@ func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = app.models.Comments.DeleteComment(commentID, user.ID)
+	// Users with the comments:moderate permission can delete anyone's comment, everyone else only their own.
+	// Through an API key, the key must have been given the comments:moderate scope as well.
+	permissions, err := app.userPermissions(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	moderator := permissions.Include(data.PermissionCommentsModerate)
+	if key := app.contextGetAPIKey(r); key != nil && !key.HasScope(data.APIKeyScopeCommentsModerate) {
+		moderator = false
+	}
+
+	if moderator {
+		err = app.models.Comments.DeleteCommentAsModerator(commentID)
+	} else {
+		err = app.models.Comments.DeleteComment(commentID, user.ID)
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -9,10 +9,13 @@ import (
 	"dev.theenthusiast.text-bin/internal/validator"
 )
 
+// createAuthenticationTokenHandler will be used to log in. Browser clients can ask for the session to be kept
+// in cookies, and are given the CSRF token to send along with their requests instead of the tokens.
 func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Cookie   bool   `json:"cookie"`
 	}
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -52,13 +55,102 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	accessToken, refreshToken, err := app.models.Tokens.NewSession(user.ID, app.storedAccessTokenTTL(), app.config.auth.refreshTokenTTL, r.UserAgent(), app.clientIP(r))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if app.config.auth.tokenMode == tokenModeJWT {
+		accessToken, err = app.newSignedToken(user, refreshToken.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if input.Cookie {
+		app.writeSessionCookies(w, r, http.StatusCreated, accessToken, refreshToken)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": accessToken, "refresh_token": refreshToken}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshAuthenticationTokenHandler will be used to exchange a refresh token for a new authentication token.
+// The refresh token is replaced by a new one as well, and can't be used again. Browser clients that logged in
+// with cookies leave the refresh token out of the body, and get new cookies instead.
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	fromCookie := false
+	if input.RefreshToken == "" {
+		if cookie, err := r.Cookie(refreshCookieName); err == nil {
+			if !app.validCSRFToken(r) {
+				app.invalidCSRFTokenResponse(w, r)
+				return
+			}
+
+			input.RefreshToken = cookie.Value
+			fromCookie = true
+		}
+	}
+
+	v := validator.New()
+	v.Check(input.RefreshToken != "", "refresh_token", "must be provided")
+	v.Check(len(input.RefreshToken) == 26, "refresh_token", "must be 26 bytes long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	accessToken, refreshToken, err := app.models.Tokens.RotateSession(input.RefreshToken, app.storedAccessTokenTTL(), app.config.auth.refreshTokenTTL, r.UserAgent(), app.clientIP(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTokenReused):
+			app.logger.PrintInfo("refresh token reused, session revoked", map[string]string{"ip": app.clientIP(r)})
+			app.loadRevokedSessions()
+			app.invalidRefreshTokenResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidRefreshTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Signed tokens carry the details of the user, which are looked up again so that they are up to date
+	if app.config.auth.tokenMode == tokenModeJWT {
+		user, err := app.models.Users.GetForToken(data.ScopeRefresh, refreshToken.Plaintext)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		accessToken, err = app.newSignedToken(user, *refreshToken.FamilyID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if fromCookie {
+		app.writeSessionCookies(w, r, http.StatusCreated, accessToken, refreshToken)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": accessToken, "refresh_token": refreshToken}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -117,3 +209,65 @@ func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// createActivationTokenHandler will be used to send a new activation email to a user who hasn't activated their account yet
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no matching email address found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.Activated {
+		v.AddError("email", "user has already been activated")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		data := map[string]interface{}{
+			"activationToken": token.Plaintext,
+			"userID":          user.ID,
+		}
+		err := app.mailer.Send(user.Email, "user_welcome.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	env := envelope{"message": "an email will be sent to you containing activation instructions"}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -230,12 +230,6 @@ func (app *application) deleteAccountHandler(w http.ResponseWriter, r *http.Requ
 	// Get the authenticated user from the request context
 	user := app.contextGetUser(r)
 
-	// Check if the user is authenticated
-	if user.IsAnonymous() {
-		app.authenticationRequiredResponse(w, r)
-		return
-	}
-
 	// Get the user ID from the request parameters
 	userIDToDelete, err := app.readIntParam(r, "id")
 	if err != nil {
@@ -243,34 +237,46 @@ func (app *application) deleteAccountHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Check if the authenticated user is trying to delete their own account
+	// Deleting someone else's account needs the admin:users permission
 	if user.ID != userIDToDelete {
-		app.notPermittedResponse(w, r)
-		return
+		permissions, err := app.userPermissions(r)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include(data.PermissionAdminUsers) {
+			app.notPermittedResponse(w, r)
+			return
+		}
 	}
 
 	// Proceed with account deletion
-	err = app.models.Users.DeleteUser(user.ID)
+	err = app.models.Users.DeleteUser(userIDToDelete)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrLastOwner):
+			app.failedValidationResponse(w, r, map[string]string{"account": "is the only owner of an organization, which must be given another owner first"})
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	// Clear the authentication token cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-	})
+	// The sessions of the account are deleted along with it, so there is nothing to log out of.
+	// Signed tokens issued for them are refused once the revoked sessions are reloaded.
+	app.loadRevokedSessions()
+
+	message := "Your account has been successfully deleted"
+	if user.ID != userIDToDelete {
+		message = "account successfully deleted"
+	} else if _, err := r.Cookie(sessionCookieName); err == nil {
+		app.clearSessionCookies(w)
+	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "Your account has been successfully deleted"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": message}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -0,0 +1,207 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"dev.theenthusiast.text-bin/internal/validator"
+	"github.com/lib/pq"
+)
+
+// APIKeyPrefix starts every API key, so the authenticate middleware can tell them apart from
+// authentication tokens
+const APIKeyPrefix = "tbk_"
+
+// The scopes an API key can be limited to. Writing texts and comments and moderating comments
+// also need the user to have the permission of the same name.
+const (
+	APIKeyScopeTextsRead        = "texts:read"
+	APIKeyScopeTextsWrite       = PermissionTextsWrite
+	APIKeyScopeCommentsWrite    = PermissionCommentsWrite
+	APIKeyScopeCommentsModerate = PermissionCommentsModerate
+)
+
+// APIKeyScopes are all the scopes an API key can be given
+var APIKeyScopes = []string{APIKeyScopeTextsRead, APIKeyScopeTextsWrite, APIKeyScopeCommentsWrite, APIKeyScopeCommentsModerate}
+
+// APIKey is a long-lived credential for scripts and CI jobs. The plaintext key is only known when
+// the key is created.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Plaintext  string     `json:"key,omitempty"`
+	Hash       []byte     `json:"-"`
+	UserID     int64      `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	Expiry     *time.Time `json:"expiry"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// HasScope reports whether the API key has been given the scope
+func (k *APIKey) HasScope(scope string) bool {
+	for i := range k.Scopes {
+		if k.Scopes[i] == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(key.Scopes) > 0, "scopes", "must contain at least one scope")
+	seen := make(map[string]bool)
+	for _, scope := range key.Scopes {
+		v.Check(v.In(scope, APIKeyScopes...), "scopes", "must only contain "+strings.Join(APIKeyScopes, ", "))
+		v.Check(!seen[scope], "scopes", "must not contain duplicate values")
+		seen[scope] = true
+	}
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expires", "must be greater than the current time")
+	}
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+// New generates an API key for the user and inserts it into the api_keys table. A nil expiry means
+// the key stays valid until it is revoked.
+func (m APIKeyModel) New(key *APIKey) error {
+	randomBytes := make([]byte, 20)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+	key.Plaintext = APIKeyPrefix + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+
+	query := `
+		INSERT INTO api_keys (user_id, name, hash, scopes, expiry)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	args := []interface{}{key.UserID, key.Name, key.Hash, pq.Array(key.Scopes), key.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetAllForUser returns the API keys of the user that haven't expired, most recently created first
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	query := `
+		SELECT id, created_at, name, user_id, scopes, expiry, last_used_at
+		FROM api_keys
+		WHERE user_id = $1 AND (expiry IS NULL OR expiry > NOW())
+		ORDER BY created_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		var key APIKey
+		err := rows.Scan(&key.ID, &key.CreatedAt, &key.Name, &key.UserID, pq.Array(&key.Scopes), &key.Expiry, &key.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Delete revokes an API key of the user
+func (m APIKeyModel) Delete(id, userID int64) error {
+	query := `
+		DELETE FROM api_keys
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetForKey returns the user an API key belongs to along with the key itself. The last use of the
+// key is recorded in the same statement, at most once every sessionTouchInterval.
+func (m APIKeyModel) GetForKey(plaintext string) (*User, *APIKey, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	query := `
+		WITH touched AS (
+			UPDATE api_keys SET last_used_at = NOW()
+			WHERE hash = $1 AND (expiry IS NULL OR expiry > $2)
+			AND (last_used_at IS NULL OR last_used_at < $3)
+		)
+		SELECT u.id, u.created_at, u.name, u.email, u.password_hash, u.activated, u.version,
+		       k.id, k.created_at, k.name, k.scopes, k.expiry, k.last_used_at
+		FROM users u
+		JOIN api_keys k ON u.id = k.user_id
+		WHERE k.hash = $1 AND (k.expiry IS NULL OR k.expiry > $2)`
+
+	now := time.Now()
+	var user User
+	var key APIKey
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:], now, now.Add(-sessionTouchInterval)).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&key.ID,
+		&key.CreatedAt,
+		&key.Name,
+		pq.Array(&key.Scopes),
+		&key.Expiry,
+		&key.LastUsedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+	key.UserID = user.ID
+	key.Hash = hash[:]
+
+	return &user, &key, nil
+}
@@ -56,3 +56,29 @@ func (m CommentModel) DeleteComment(commentID, userID int64) error {
 
     return nil
 }
+
+// DeleteCommentAsModerator deletes a comment regardless of who wrote it
+func (m CommentModel) DeleteCommentAsModerator(commentID int64) error {
+    query := `
+        DELETE FROM comments
+        WHERE id = $1`
+
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+
+    result, err := m.DB.ExecContext(ctx, query, commentID)
+    if err != nil {
+        return err
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return err
+    }
+
+    if rowsAffected == 0 {
+        return ErrRecordNotFound
+    }
+
+    return nil
+}
@@ -13,20 +13,30 @@ var (
 
 // Define a Models type which wraps the MovieModel.
 type Models struct {
-	Texts    TextModel
-	Users    UserModel
-	Tokens   TokenModel
-	Comments CommentModel
-	Likes    LikeModel
+	Texts       TextModel
+	Users       UserModel
+	Tokens      TokenModel
+	Comments    CommentModel
+	Likes       LikeModel
+	Revisions   RevisionModel
+	Shares      ShareModel
+	Orgs        OrgModel
+	Permissions PermissionModel
+	APIKeys     APIKeyModel
 }
 
 // Define a NewModels() function which initializes the MovieModel and stores it in the Models type.
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Texts:    TextModel{DB: db},
-		Users:    UserModel{DB: db},
-		Tokens:   TokenModel{DB: db},
-		Comments: CommentModel{DB: db},
-		Likes:    LikeModel{DB: db},
+		Texts:       TextModel{DB: db},
+		Users:       UserModel{DB: db},
+		Tokens:      TokenModel{DB: db},
+		Comments:    CommentModel{DB: db},
+		Likes:       LikeModel{DB: db},
+		Revisions:   RevisionModel{DB: db},
+		Shares:      ShareModel{DB: db},
+		Orgs:        OrgModel{DB: db},
+		Permissions: PermissionModel{DB: db},
+		APIKeys:     APIKeyModel{DB: db},
 	}
 }
@@ -0,0 +1,494 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"dev.theenthusiast.text-bin/internal/validator"
+)
+
+// The roles of organization members, from most to least privileged. Owners can do everything,
+// including deleting the organization. Admins manage members and can edit or delete any text of
+// the organization, members can create and edit its texts, and viewers can only read them.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+	RoleViewer = "viewer"
+)
+
+// ErrAlreadyMember is returned when an invitation is accepted by someone who is already a member
+var ErrAlreadyMember = errors.New("already a member")
+
+// ErrLastOwner is returned when a change would leave an organization without any owner
+var ErrLastOwner = errors.New("last owner")
+
+// Org is an organization that texts can belong to. Role is the role of the user it was fetched for.
+type Org struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role,omitempty"`
+	Version   int32     `json:"-"`
+}
+
+// OrgMember is a user that belongs to an organization
+type OrgMember struct {
+	OrgID     int64     `json:"org_id"`
+	UserID    int64     `json:"user_id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrgInvitation invites the owner of an email address to join an organization with a role
+type OrgInvitation struct {
+	Plaintext string    `json:"-"`
+	Hash      []byte    `json:"-"`
+	OrgID     int64     `json:"org_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy int64     `json:"invited_by"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+// RoleAtLeast reports whether the role is the minimum role or a more privileged one
+func RoleAtLeast(role, minimum string) bool {
+	rank := map[string]int{RoleViewer: 1, RoleMember: 2, RoleAdmin: 3, RoleOwner: 4}
+	return rank[role] > 0 && rank[role] >= rank[minimum]
+}
+
+func ValidateOrg(v *validator.Validator, org *Org) {
+	v.Check(org.Name != "", "name", "must be provided")
+	v.Check(len(org.Name) <= 100, "name", "must not be more than 100 bytes long")
+}
+
+func ValidateRole(v *validator.Validator, role string) {
+	v.Check(v.In(role, RoleOwner, RoleAdmin, RoleMember, RoleViewer), "role", "must be owner, admin, member or viewer")
+}
+
+type OrgModel struct {
+	DB *sql.DB
+}
+
+// Insert creates the organization with the user as its first owner
+func (m OrgModel) Insert(org *Org, ownerID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO organizations (name)
+        VALUES ($1)
+        RETURNING id, created_at, version`
+
+	err = tx.QueryRowContext(ctx, query, org.Name).Scan(&org.ID, &org.CreatedAt, &org.Version)
+	if err != nil {
+		return err
+	}
+
+	query = `
+        INSERT INTO organization_members (org_id, user_id, role)
+        VALUES ($1, $2, $3)`
+
+	_, err = tx.ExecContext(ctx, query, org.ID, ownerID, RoleOwner)
+	if err != nil {
+		return err
+	}
+	org.Role = RoleOwner
+
+	return tx.Commit()
+}
+
+// GetForUser returns the organization with the role the user has in it. Organizations are only
+// visible to their members, so ErrRecordNotFound is returned when the user is not one.
+func (m OrgModel) GetForUser(orgID, userID int64) (*Org, error) {
+	query := `
+        SELECT organizations.id, organizations.created_at, organizations.name, organizations.version, organization_members.role
+        FROM organizations
+        INNER JOIN organization_members ON organization_members.org_id = organizations.id
+        WHERE organizations.id = $1 AND organization_members.user_id = $2`
+
+	var org Org
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, orgID, userID).Scan(&org.ID, &org.CreatedAt, &org.Name, &org.Version, &org.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &org, nil
+}
+
+// GetAllForUser returns the organizations the user is a member of
+func (m OrgModel) GetAllForUser(userID int64) ([]*Org, error) {
+	query := `
+        SELECT organizations.id, organizations.created_at, organizations.name, organizations.version, organization_members.role
+        FROM organizations
+        INNER JOIN organization_members ON organization_members.org_id = organizations.id
+        WHERE organization_members.user_id = $1
+        ORDER BY organizations.name, organizations.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*Org{}
+
+	for rows.Next() {
+		var org Org
+		err := rows.Scan(&org.ID, &org.CreatedAt, &org.Name, &org.Version, &org.Role)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, &org)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// Update renames the organization, using the version for optimistic locking
+func (m OrgModel) Update(org *Org) error {
+	query := `
+        UPDATE organizations
+        SET name = $1, version = version + 1
+        WHERE id = $2 AND version = $3
+        RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, org.Name, org.ID, org.Version).Scan(&org.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes the organization. Its memberships, invitations and texts are removed by the
+// ON DELETE CASCADE constraints.
+func (m OrgModel) Delete(orgID int64) error {
+	query := `
+        DELETE FROM organizations
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, orgID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetMembers returns the members of the organization, most privileged roles first
+func (m OrgModel) GetMembers(orgID int64) ([]*OrgMember, error) {
+	query := `
+        SELECT organization_members.org_id, organization_members.user_id, users.email, users.name,
+               organization_members.role, organization_members.created_at
+        FROM organization_members
+        INNER JOIN users ON users.id = organization_members.user_id
+        WHERE organization_members.org_id = $1
+        ORDER BY array_position(ARRAY['owner', 'admin', 'member', 'viewer'], organization_members.role), users.name, users.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*OrgMember{}
+
+	for rows.Next() {
+		var member OrgMember
+		err := rows.Scan(&member.OrgID, &member.UserID, &member.Email, &member.Name, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// GetMember returns a single member of the organization
+func (m OrgModel) GetMember(orgID, userID int64) (*OrgMember, error) {
+	query := `
+        SELECT organization_members.org_id, organization_members.user_id, users.email, users.name,
+               organization_members.role, organization_members.created_at
+        FROM organization_members
+        INNER JOIN users ON users.id = organization_members.user_id
+        WHERE organization_members.org_id = $1 AND organization_members.user_id = $2`
+
+	var member OrgMember
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, orgID, userID).Scan(&member.OrgID, &member.UserID, &member.Email, &member.Name, &member.Role, &member.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &member, nil
+}
+
+// keepOwner locks the owners of the organization for the rest of the transaction, and returns ErrLastOwner
+// when the user is its only owner. Concurrent changes to the members wait for the lock and then see the
+// owners as they are after it, so two owners can't demote each other at the same time.
+func keepOwner(ctx context.Context, tx *sql.Tx, orgID, userID int64) error {
+	query := `
+        SELECT user_id FROM organization_members
+        WHERE org_id = $1 AND role = $2
+        FOR UPDATE`
+
+	rows, err := tx.QueryContext(ctx, query, orgID, RoleOwner)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	owners := 0
+	isOwner := false
+	for rows.Next() {
+		var ownerID int64
+		err := rows.Scan(&ownerID)
+		if err != nil {
+			return err
+		}
+		owners++
+		isOwner = isOwner || ownerID == userID
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if isOwner && owners <= 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// SetMemberRole changes the role of a member of the organization. ErrLastOwner is returned when the
+// member is the only owner and the new role isn't owner.
+func (m OrgModel) SetMemberRole(orgID, userID int64, role string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if role != RoleOwner {
+		err = keepOwner(ctx, tx, orgID, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+        UPDATE organization_members
+        SET role = $3
+        WHERE org_id = $1 AND user_id = $2`
+
+	result, err := tx.ExecContext(ctx, query, orgID, userID, role)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return tx.Commit()
+}
+
+// RemoveMember removes the user from the organization. The texts they created for it stay with the organization.
+// ErrLastOwner is returned when the user is its only owner.
+func (m OrgModel) RemoveMember(orgID, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = keepOwner(ctx, tx, orgID, userID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        DELETE FROM organization_members
+        WHERE org_id = $1 AND user_id = $2`
+
+	result, err := tx.ExecContext(ctx, query, orgID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return tx.Commit()
+}
+
+// NewInvitation creates an invitation to join the organization, replacing any earlier invitation
+// for the same email address. The plaintext token is generated the same way as other tokens.
+func (m OrgModel) NewInvitation(orgID int64, email, role string, invitedBy int64, ttl time.Duration) (*OrgInvitation, error) {
+	token, err := generateToken(invitedBy, ttl, "")
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := &OrgInvitation{
+		Plaintext: token.Plaintext,
+		Hash:      token.Hash,
+		OrgID:     orgID,
+		Email:     email,
+		Role:      role,
+		InvitedBy: invitedBy,
+		Expiry:    token.Expiry,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM organization_invitations WHERE org_id = $1 AND email = $2`, orgID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO organization_invitations (hash, org_id, email, role, invited_by, expiry)
+        VALUES ($1, $2, $3, $4, $5, $6)`
+
+	args := []interface{}{invitation.Hash, invitation.OrgID, invitation.Email, invitation.Role, invitation.InvitedBy, invitation.Expiry}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return invitation, tx.Commit()
+}
+
+// AcceptInvitation adds the user to the organization with the role they were invited with. The
+// invitation must be for the organization and the email address of the user, and is used up.
+func (m OrgModel) AcceptInvitation(orgID int64, tokenPlaintext string, user *User) (*Org, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        DELETE FROM organization_invitations
+        WHERE hash = $1 AND org_id = $2 AND email = $3 AND expiry > $4
+        RETURNING role`
+
+	var role string
+	err = tx.QueryRowContext(ctx, query, tokenHash[:], orgID, user.Email, time.Now()).Scan(&role)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+        INSERT INTO organization_members (org_id, user_id, role)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (org_id, user_id) DO NOTHING`
+
+	result, err := tx.ExecContext(ctx, query, orgID, user.ID, role)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrAlreadyMember
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.GetForUser(orgID, user.ID)
+}
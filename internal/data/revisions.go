@@ -0,0 +1,101 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Revision is a snapshot of a text's title, content and format at a given version
+type Revision struct {
+	ID        int64     `json:"id"`
+	TextID    int64     `json:"text_id"`
+	Version   int32     `json:"version"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content,omitempty"`
+	Format    string    `json:"format"`
+	UserID    *int64    `json:"user_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+// insertRevision records the current state of the text as a revision. It runs inside the
+// transaction that created or updated the text, so a revision exists for every version.
+func insertRevision(ctx context.Context, tx *sql.Tx, text *Text, userID *int64) error {
+	query := `
+        INSERT INTO text_revisions (text_id, version, title, content, format, user_id)
+        VALUES ($1, $2, $3, $4, $5, $6)`
+
+	args := []interface{}{text.ID, text.Version, text.Title, text.Content, text.Format, userID}
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// GetAllForText returns the revisions of a text, newest first. Content is left out to keep the list small.
+func (m RevisionModel) GetAllForText(textID int64) ([]*Revision, error) {
+	query := `
+        SELECT id, text_id, version, title, format, user_id, created_at
+        FROM text_revisions
+        WHERE text_id = $1
+        ORDER BY version DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, textID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		var revision Revision
+		err := rows.Scan(
+			&revision.ID, &revision.TextID, &revision.Version, &revision.Title,
+			&revision.Format, &revision.UserID, &revision.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Get returns a specific version of a text including its content
+func (m RevisionModel) Get(textID int64, version int32) (*Revision, error) {
+	query := `
+        SELECT id, text_id, version, title, content, format, user_id, created_at
+        FROM text_revisions
+        WHERE text_id = $1 AND version = $2`
+
+	var revision Revision
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, textID, version).Scan(
+		&revision.ID, &revision.TextID, &revision.Version, &revision.Title,
+		&revision.Content, &revision.Format, &revision.UserID, &revision.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &revision, nil
+}
@@ -0,0 +1,125 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"dev.theenthusiast.text-bin/internal/validator"
+)
+
+// The access a share grants. Read lets the user see the text even when it is private, and edit
+// also lets them update it.
+const (
+	SharePermissionRead = "read"
+	SharePermissionEdit = "edit"
+)
+
+// Share grants another user access to a text
+type Share struct {
+	TextID     int64     `json:"text_id"`
+	UserID     int64     `json:"user_id"`
+	Email      string    `json:"email"`
+	Name       string    `json:"name"`
+	Permission string    `json:"permission"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func ValidateShare(v *validator.Validator, share *Share) {
+	ValidateEmail(v, share.Email)
+	v.Check(v.In(share.Permission, SharePermissionRead, SharePermissionEdit), "permission", "must be read or edit")
+}
+
+type ShareModel struct {
+	DB *sql.DB
+}
+
+// Grant shares the text with the user that has the email address, or changes the permission of
+// an existing share. It returns ErrRecordNotFound when no user has that email address.
+func (m ShareModel) Grant(share *Share) error {
+	query := `
+        WITH share AS (
+            INSERT INTO text_shares (text_id, user_id, permission)
+            SELECT $1, id, $3 FROM users WHERE email = $2
+            ON CONFLICT (text_id, user_id) DO UPDATE SET permission = EXCLUDED.permission
+            RETURNING user_id, created_at
+        )
+        SELECT share.user_id, share.created_at, users.name
+        FROM share
+        INNER JOIN users ON users.id = share.user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, share.TextID, share.Email, share.Permission).Scan(&share.UserID, &share.CreatedAt, &share.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Revoke removes the share of the text with the user that has the email address
+func (m ShareModel) Revoke(textID int64, email string) error {
+	query := `
+        DELETE FROM text_shares
+        USING users
+        WHERE text_shares.user_id = users.id AND text_shares.text_id = $1 AND users.email = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, textID, email)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAllForText returns the users a text is shared with, in the order they were added
+func (m ShareModel) GetAllForText(textID int64) ([]*Share, error) {
+	query := `
+        SELECT text_shares.text_id, text_shares.user_id, users.email, users.name, text_shares.permission, text_shares.created_at
+        FROM text_shares
+        INNER JOIN users ON users.id = text_shares.user_id
+        WHERE text_shares.text_id = $1
+        ORDER BY text_shares.created_at, text_shares.user_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, textID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []*Share{}
+
+	for rows.Next() {
+		var share Share
+		err := rows.Scan(&share.TextID, &share.UserID, &share.Email, &share.Name, &share.Permission, &share.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, &share)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shares, nil
+}
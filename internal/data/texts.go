@@ -2,6 +2,8 @@ package data
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -16,31 +18,191 @@ import (
 // Its important in Go to keep the Fields of a struct in Capotal letter to make it public
 // Any field that starts with a lowercase letter is private to the package and aren't  exported and won't be included when encoding a struct to JSON
 type Text struct {
-	ID             int64     `json:"id"`
-	CreatedAt      time.Time `json:"-"`
-	Title          string    `json:"title"`
-	Content        string    `json:"content"`
-	Format         string    `json:"format"`
-	Expires        time.Time `json:"expires"`
-	Slug           string    `json:"slug"`
-	IsPrivate      bool      `json:"is_private"`
-	UserID         *int64    `json:"user_id,omitempty"`
-	LikesCount     int       `json:"likes_count"`
-	Comments       []Comment `json:"comments,omitempty"`
-	EncryptionSalt string    `json:"encryption_salt"`
-	Version        int32     `json:"-"`
-}
-
-// ValidateText will be used to validate the input data for the Text struct
-func ValidateText(v *validator.Validator, text *Text) {
+	ID                int64      `json:"id"`
+	CreatedAt         time.Time  `json:"-"`
+	Title             string     `json:"title"`
+	Content           string     `json:"content,omitempty"`
+	Preview           string     `json:"preview,omitempty"`
+	Size              int        `json:"size,omitempty"`
+	Format            string     `json:"format"`
+	Expires           *time.Time `json:"expires"`
+	Slug              string     `json:"slug"`
+	Visibility        string     `json:"visibility"`
+	BurnAfterRead     bool       `json:"burn_after_read"`
+	Password          password   `json:"-"`
+	PasswordProtected bool       `json:"password_protected"`
+	UserID            *int64     `json:"user_id,omitempty"`
+	OrgID             *int64     `json:"org_id,omitempty"`
+	LikesCount        int        `json:"likes_count"`
+	Comments          []Comment  `json:"comments,omitempty"`
+	EncryptionSalt    string     `json:"encryption_salt"`
+	EditSecret        string     `json:"edit_secret,omitempty"`
+	Version           int32      `json:"-"`
+
+	// sharePermission is the permission of the share granted to the user the text was fetched for, if any
+	sharePermission string
+	// orgRole is the role in the organization of the text of the user the text was fetched for, if any
+	orgRole string
+	// editSecretHash is the hash of the secret that lets anyone holding it update or delete an anonymous text
+	editSecretHash []byte
+}
+
+// The visibility of a text. Public texts are listed and searchable, unlisted texts can only be
+// reached by their link, private texts are only visible to their owner, and org texts are visible
+// to the members of the organization they belong to.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+	VisibilityOrg      = "org"
+)
+
+// ExpiryPolicy describes how long texts may live. A zero Default means texts never expire unless
+// asked to, and a zero Max means texts are allowed to never expire.
+type ExpiryPolicy struct {
+	Default time.Duration
+	Max     time.Duration
+}
+
+// ValidateText will be used to validate the input data for the Text struct.
+// A nil Expires means the text never expires, which is only allowed if the policy has no maximum lifetime.
+func ValidateText(v *validator.Validator, text *Text, policy ExpiryPolicy) {
 	v.Check(text.Title != "", "title", "must be provided")
 	v.Check(len(text.Title) <= 100, "title", "must not be more than 100 bytes long")
 	v.Check(text.Content != "", "content", "must be provided")
 	v.Check(len(text.Content) <= 1000000, "content", "must not be more than 1000000 bytes long")
 	v.Check(text.Format != "", "format", "must be provided")
-	v.Check(text.Expires.After(time.Now()), "expires", "must be greater than the current time")
-	v.Check(text.UserID != nil || !text.IsPrivate, "is_private", "anonymous users cannot create private texts")
+	if text.Expires != nil {
+		v.Check(text.Expires.After(time.Now()), "expires", "must be greater than the current time")
+		if policy.Max > 0 {
+			v.Check(!text.Expires.After(time.Now().Add(policy.Max)), "expires", fmt.Sprintf("must not be more than %s in the future", formatLifetime(policy.Max)))
+		}
+	} else {
+		v.Check(policy.Max == 0, "expires", fmt.Sprintf("must be provided and not be more than %s in the future", formatLifetime(policy.Max)))
+	}
+	v.Check(v.In(text.Visibility, VisibilityPublic, VisibilityUnlisted, VisibilityPrivate, VisibilityOrg), "visibility", "must be public, unlisted, private or org")
+	v.Check(text.OrgID != nil || text.Visibility != VisibilityOrg, "visibility", "only texts that belong to an organization can be visible to it")
+	v.Check(text.UserID != nil || text.Visibility != VisibilityPrivate, "visibility", "anonymous users cannot create private texts")
+	if text.Password.plaintext != nil {
+		ValidatePasswordPlaintext(v, *text.Password.plaintext)
+	}
+
+}
+
+// formatLifetime formats a duration in whole days when possible, as lifetimes are usually set in days
+func formatLifetime(d time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case d%day == 0 && d == day:
+		return "1 day"
+	case d%day == 0:
+		return fmt.Sprintf("%d days", d/day)
+	default:
+		return d.String()
+	}
+}
+
+// ErrTextBurned is returned when a burn after read text has already been read
+var ErrTextBurned = errors.New("text burned after reading")
 
+// SetPassword protects the text with an access password, which readers other than the owner must provide
+func (t *Text) SetPassword(plaintextPassword string) error {
+	err := t.Password.Set(plaintextPassword)
+	if err != nil {
+		return err
+	}
+	t.PasswordProtected = true
+	return nil
+}
+
+// RemovePassword makes the text readable without an access password again
+func (t *Text) RemovePassword() {
+	t.Password = password{}
+	t.PasswordProtected = false
+}
+
+// OwnedBy reports whether the user with the given ID created the text. Org texts belong to their
+// organization rather than to whoever created them, so the rights over them come from the role of the
+// user in the organization alone, and a creator who has left it has none.
+func (t *Text) OwnedBy(userID *int64) bool {
+	return userID != nil && t.UserID != nil && *userID == *t.UserID && t.OrgID == nil
+}
+
+// SharedWith reports whether the user with the given ID manages the text or has been granted access to it
+func (t *Text) SharedWith(userID *int64) bool {
+	return t.ManagedBy(userID) || (userID != nil && t.sharePermission != "")
+}
+
+// SetEditSecret generates the secret that lets whoever created an anonymous text update or delete it.
+// The plaintext is only kept in EditSecret so it can be returned once, when the text is created.
+func (t *Text) SetEditSecret() error {
+	token, err := generateToken(0, 0, "")
+	if err != nil {
+		return err
+	}
+	t.EditSecret = token.Plaintext
+	t.editSecretHash = token.Hash
+	return nil
+}
+
+// editSecretMatches reports whether the plaintext is the edit secret of the text
+func (t *Text) editSecretMatches(plaintext string) bool {
+	if t.editSecretHash == nil || plaintext == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare(hashEditSecret(plaintext), t.editSecretHash) == 1
+}
+
+// hashEditSecret hashes an edit secret the way it is stored, or returns nil if there is none
+func hashEditSecret(plaintext string) []byte {
+	if plaintext == "" {
+		return nil
+	}
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+// EditableBy reports whether the user with the given ID may update the text. That is its owner,
+// users it is shared with for editing, members of its organization other than viewers, and anyone
+// holding the edit secret of an anonymous text.
+func (t *Text) EditableBy(userID *int64, editSecret string) bool {
+	if t.editSecretMatches(editSecret) {
+		return true
+	}
+	if userID == nil {
+		return false
+	}
+	return t.OwnedBy(userID) || t.sharePermission == SharePermissionEdit || RoleAtLeast(t.orgRole, RoleMember)
+}
+
+// ManagedBy reports whether the user with the given ID may change who can read the text and for how long:
+// its visibility, password, burn after read setting, expiry and shares. Only its owner may, or the owners
+// and admins of its organization for an org text; other editors can only change its title, content and format.
+func (t *Text) ManagedBy(userID *int64) bool {
+	return t.OwnedBy(userID) || (userID != nil && RoleAtLeast(t.orgRole, RoleAdmin))
+}
+
+// DeletableBy reports whether the user with the given ID may delete the text. That is its owner,
+// owners and admins of its organization, and anyone holding the edit secret of an anonymous text.
+func (t *Text) DeletableBy(userID *int64, editSecret string) bool {
+	if t.editSecretMatches(editSecret) {
+		return true
+	}
+	return t.ManagedBy(userID)
+}
+
+// visibleTo reports whether the user with the given ID may read the text. Private texts are only
+// visible to their owner and the users it is shared with, and org texts also to the members of
+// the organization.
+func (t *Text) visibleTo(userID *int64) bool {
+	switch t.Visibility {
+	case VisibilityPrivate:
+		return t.SharedWith(userID)
+	case VisibilityOrg:
+		return t.SharedWith(userID) || (userID != nil && t.orgRole != "")
+	default:
+		return true
+	}
 }
 
 // GenerateRandomCode generates a random string of specified length
@@ -61,8 +223,8 @@ type TextModel struct {
 // Insert will add a new record to the texts table
 func (m TextModel) Insert(text *Text) error {
 	query := `
-        INSERT INTO texts (title, content, format, expires, slug, user_id, is_private, encryption_salt)
-        VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+        INSERT INTO texts (title, content, format, expires, slug, user_id, org_id, visibility, encryption_salt, burn_after_read, access_password_hash, edit_secret_hash)
+        VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
         RETURNING id, created_at, version
     `
 	args := []interface{}{
@@ -72,17 +234,34 @@ func (m TextModel) Insert(text *Text) error {
 		text.Expires,
 		text.Slug,
 		text.UserID,
-		text.IsPrivate,
+		text.OrgID,
+		text.Visibility,
 		text.EncryptionSalt,
+		text.BurnAfterRead,
+		text.Password.hash,
+		text.editSecretHash,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&text.ID, &text.CreatedAt, &text.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&text.ID, &text.CreatedAt, &text.Version)
 	if err != nil {
 		return fmt.Errorf("failed to insert text: %v", err)
 	}
-	return nil
+
+	// Record the initial content as the first revision of the text
+	err = insertRevision(ctx, tx, text, text.UserID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 var randomSource rand.Source
@@ -144,28 +323,226 @@ func generateRandomString(length int) string {
 }
 func (m TextModel) slugExists(slug string) (bool, error) {
 	var exists bool
-	query := "SELECT EXISTS(SELECT 1 FROM texts WHERE slug = $1)"
+	// Slugs of burned texts are never handed out again
+	query := "SELECT EXISTS(SELECT 1 FROM texts WHERE slug = $1) OR EXISTS(SELECT 1 FROM burned_texts WHERE slug = $1)"
 	err := m.DB.QueryRow(query, slug).Scan(&exists)
 	return exists, err
 }
 
-// Get will return a specific record from the texts table based on the id
+// Get will return a specific record from the texts table based on the id.
+// Texts that have expired are treated as not found. Burn after read texts are only returned to their
+// owner, and password protected texts to their owner and the users they are shared with; everybody
+// else has to go through Read.
 func (m TextModel) Get(slug string, userID *int64) (*Text, error) {
+	return m.GetWithEditSecret(slug, userID, "")
+}
+
+// GetWithEditSecret will return a text like Get does, but also returns burn after read and password
+// protected anonymous texts to whoever holds their edit secret, so they can still update or delete them.
+func (m TextModel) GetWithEditSecret(slug string, userID *int64, editSecret string) (*Text, error) {
+	text, err := m.get(slug, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if text.editSecretMatches(editSecret) {
+		return text, nil
+	}
+	if text.BurnAfterRead && !text.ManagedBy(userID) {
+		return nil, ErrRecordNotFound
+	}
+	if text.PasswordProtected && !text.SharedWith(userID) {
+		return nil, ErrRecordNotFound
+	}
+
+	return text, nil
+}
+
+// Read will return a text for display like Get does, but including burn after read and password
+// protected texts. It returns ErrTextBurned for a burn after read text that is already gone.
+// Checking the password and calling Burn afterwards is up to the caller.
+func (m TextModel) Read(slug string, userID *int64) (*Text, error) {
+	text, err := m.get(slug, userID)
+	if err != nil {
+		if errors.Is(err, ErrRecordNotFound) {
+			burned, burnedErr := m.isBurned(slug)
+			if burnedErr != nil {
+				return nil, burnedErr
+			}
+			if burned {
+				return nil, ErrTextBurned
+			}
+		}
+		return nil, err
+	}
+
+	return text, nil
+}
+
+// ReadWithShareLink will return a text for display to anyone holding a share link for it, whatever
+// the visibility of the text. Every use of the link counts as a view, and ErrRecordNotFound is
+// returned when the link is not valid for the text, has expired or has no views left.
+func (m TextModel) ReadWithShareLink(slug, tokenPlaintext string) (*Text, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+        SELECT user_id
+        FROM tokens
+        WHERE hash = $1 AND scope = $2 AND expiry > $3
+        AND (max_views IS NULL OR views < max_views)
+        AND text_id = (SELECT id FROM texts WHERE slug = $4)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var ownerID int64
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], ScopeShareLink, time.Now(), slug).Scan(&ownerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// The links of a burned text were deleted along with it
+			burned, burnedErr := m.isBurned(slug)
+			if burnedErr != nil {
+				return nil, burnedErr
+			}
+			if burned {
+				return nil, ErrTextBurned
+			}
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	// The text is fetched on behalf of the owner who created the link, before the view is counted so
+	// that a text that can't be read doesn't use up a view
+	text, err := m.get(slug, &ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count the view in the same statement that checks the limit, so that concurrent requests
+	// can never use more views than the link allows
+	query = `
+        UPDATE tokens
+        SET views = views + 1
+        WHERE hash = $1 AND scope = $2 AND expiry > $3
+        AND (max_views IS NULL OR views < max_views)
+        AND text_id = $4`
+
+	result, err := m.DB.ExecContext(ctx, query, tokenHash[:], ScopeShareLink, time.Now(), text.ID)
+	if err != nil {
+		return nil, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	return text, nil
+}
+
+// Burn deletes a burn after read text that is being read by anyone other than its owner, in a
+// single transaction that also records the slug as burned. The DELETE locks the row, so when two
+// readers race only one of them gets the content and the other gets ErrTextBurned.
+func (m TextModel) Burn(text *Text, userID *int64) error {
+	if !text.BurnAfterRead || text.ManagedBy(userID) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-        SELECT id, created_at, title, content, format, expires, slug, version, user_id, is_private, encryption_salt,
-               (SELECT COUNT(*) FROM likes WHERE text_id = texts.id) as likes_count
+        DELETE FROM texts
+        WHERE id = $1
+        RETURNING title, content, format, version`
+
+	err = tx.QueryRowContext(ctx, query, text.ID).Scan(&text.Title, &text.Content, &text.Format, &text.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrTextBurned
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO burned_texts (slug) VALUES ($1) ON CONFLICT (slug) DO NOTHING`, text.Slug)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// isBurned reports whether the slug belonged to a burn after read text that has been read
+func (m TextModel) isBurned(slug string) (bool, error) {
+	var burned bool
+	query := "SELECT EXISTS(SELECT 1 FROM burned_texts WHERE slug = $1)"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, slug).Scan(&burned)
+	return burned, err
+}
+
+// IsBurnAfterRead reports whether the text with the given id is a burn after read text
+func (m TextModel) IsBurnAfterRead(id int64) (bool, error) {
+	var burnAfterRead bool
+	query := "SELECT burn_after_read FROM texts WHERE id = $1"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&burnAfterRead)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, ErrRecordNotFound
+		default:
+			return false, err
+		}
+	}
+	return burnAfterRead, nil
+}
+
+// get fetches a text and its comments, applying the expiry and privacy rules shared by Get and Read
+func (m TextModel) get(slug string, userID *int64) (*Text, error) {
+	query := `
+        SELECT id, created_at, title, content, format, expires, slug, version, user_id, org_id, visibility, encryption_salt,
+               burn_after_read, access_password_hash, edit_secret_hash, (SELECT COUNT(*) FROM likes WHERE text_id = texts.id) as likes_count,
+               COALESCE((SELECT permission FROM text_shares WHERE text_id = texts.id AND user_id = $2), ''),
+               COALESCE((SELECT role FROM organization_members WHERE org_id = texts.org_id AND user_id = $2), '')
         FROM texts
-        WHERE slug = $1`
+        WHERE slug = $1
+        AND (expires IS NULL OR expires > NOW())`
 
 	var text Text
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, slug).Scan(
+	err := m.DB.QueryRowContext(ctx, query, slug, userID).Scan(
 		&text.ID, &text.CreatedAt, &text.Title, &text.Content, &text.Format,
-		&text.Expires, &text.Slug, &text.Version, &text.UserID, &text.IsPrivate,
-		&text.EncryptionSalt, &text.LikesCount)
+		&text.Expires, &text.Slug, &text.Version, &text.UserID, &text.OrgID, &text.Visibility,
+		&text.EncryptionSalt, &text.BurnAfterRead, &text.Password.hash, &text.editSecretHash, &text.LikesCount,
+		&text.sharePermission, &text.orgRole)
 
 	if err != nil {
 		switch {
@@ -176,8 +553,10 @@ func (m TextModel) Get(slug string, userID *int64) (*Text, error) {
 		}
 	}
 
+	text.PasswordProtected = text.Password.hash != nil
+
 	// Check if the text is private and the user is not the owner
-	if text.IsPrivate && (userID == nil || *userID != *text.UserID) {
+	if !text.visibleTo(userID) {
 		return nil, ErrRecordNotFound
 	}
 
@@ -210,13 +589,146 @@ func (m TextModel) Get(slug string, userID *int64) (*Text, error) {
 	return &text, nil
 }
 
-// Update will update a specific record in the texts table based on the id
-// Update will update a specific record in the texts table based on the id
-func (m TextModel) Update(text *Text, userID int64) error {
+// textPreviewLength is how many characters of their content listed and searched texts carry
+const textPreviewLength = 200
+
+// GetAll will return a paginated list of texts matching the format, owner and organization filters.
+// Unlisted, private, burn after read and password protected texts are only included when userID is their owner,
+// and org texts when userID is a member of the organization. The texts carry a preview of their content and its
+// size in bytes rather than the content itself, which has to be fetched one text at a time.
+func (m TextModel) GetAll(format string, ownerID *int64, orgID *int64, userID *int64, filters Filters) ([]*Text, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at, title, left(content, $7), octet_length(content), format, expires, slug, version, user_id, org_id, visibility,
+               encryption_salt, burn_after_read, access_password_hash IS NOT NULL, (SELECT COUNT(*) FROM likes WHERE text_id = texts.id) as likes_count
+        FROM texts
+        WHERE (format = $1 OR $1 = '')
+        AND ($2::bigint IS NULL OR user_id = $2)
+        AND ($3::bigint IS NULL OR org_id = $3)
+        AND (expires IS NULL OR expires > NOW())
+        AND (visibility = 'public' OR (user_id = $4 AND org_id IS NULL)
+            OR (visibility = 'org' AND org_id IN (SELECT org_id FROM organization_members WHERE user_id = $4)))
+        AND (burn_after_read = false OR (user_id = $4 AND org_id IS NULL))
+        AND (access_password_hash IS NULL OR (user_id = $4 AND org_id IS NULL))
+        ORDER BY %s %s, id ASC
+        LIMIT $5 OFFSET $6`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{format, ownerID, orgID, userID, filters.limit(), filters.offset(), textPreviewLength}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	texts := []*Text{}
+
+	for rows.Next() {
+		var text Text
+		err := rows.Scan(
+			&totalRecords,
+			&text.ID, &text.CreatedAt, &text.Title, &text.Preview, &text.Size, &text.Format,
+			&text.Expires, &text.Slug, &text.Version, &text.UserID, &text.OrgID, &text.Visibility,
+			&text.EncryptionSalt, &text.BurnAfterRead, &text.PasswordProtected, &text.LikesCount)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		texts = append(texts, &text)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return texts, metadata, nil
+}
+
+// TextSearchResult wraps a Text matched by a full-text search with its rank and a highlighted excerpt.
+// The snippet is safe HTML: the content is escaped, and the matches are wrapped in <mark> elements.
+type TextSearchResult struct {
+	Text
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// Search will return a paginated list of texts whose title or content match the query, ranked by relevance.
+// Unlisted, private, burn after read and password protected texts only match when userID is their owner,
+// and org texts when userID is a member of the organization. Like the listing, results carry a preview
+// and the size of their content rather than the content itself.
+func (m TextModel) Search(q string, format string, userID *int64, filters Filters) ([]*TextSearchResult, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at, title, left(content, $6), octet_length(content), format, expires, slug, version, user_id, org_id,
+               visibility, encryption_salt, burn_after_read, access_password_hash IS NOT NULL,
+               (SELECT COUNT(*) FROM likes WHERE text_id = texts.id) as likes_count, ts_rank(search_vector, query) as rank,
+               ts_headline('simple', replace(replace(replace(replace(content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'),
+                           query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10')
+        FROM texts, websearch_to_tsquery('simple', $1) query
+        WHERE search_vector @@ query
+        AND (expires IS NULL OR expires > NOW())
+        AND (format = $2 OR $2 = '')
+        AND (visibility = 'public' OR (user_id = $3 AND org_id IS NULL)
+            OR (visibility = 'org' AND org_id IN (SELECT org_id FROM organization_members WHERE user_id = $3)))
+        AND (burn_after_read = false OR (user_id = $3 AND org_id IS NULL))
+        AND (access_password_hash IS NULL OR (user_id = $3 AND org_id IS NULL))
+        ORDER BY %s %s, id ASC
+        LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{q, format, userID, filters.limit(), filters.offset(), textPreviewLength}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	results := []*TextSearchResult{}
+
+	for rows.Next() {
+		var result TextSearchResult
+		err := rows.Scan(
+			&totalRecords,
+			&result.ID, &result.CreatedAt, &result.Title, &result.Preview, &result.Size, &result.Format,
+			&result.Expires, &result.Slug, &result.Version, &result.UserID, &result.OrgID, &result.Visibility,
+			&result.EncryptionSalt, &result.BurnAfterRead, &result.PasswordProtected, &result.LikesCount, &result.Rank, &result.Snippet)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return results, metadata, nil
+}
+
+// Update will update a specific record in the texts table based on the id. The same users that
+// EditableBy allows may update the text, userID being nil for anonymous users. Only the users ManagedBy allows may
+// change its expiry, visibility, burn after read setting or password.
+func (m TextModel) Update(text *Text, userID *int64, editSecret string) error {
 	query := `
         UPDATE texts
-        SET title = $1, content = $2, format = $3, expires = $4, is_private = $5, encryption_salt = $6, version = version + 1
-        WHERE slug = $7 AND version = $8 AND (user_id = $9 OR user_id IS NULL)
+        SET title = $1, content = $2, format = $3, expires = $4, visibility = $5, encryption_salt = $6, burn_after_read = $7,
+            access_password_hash = $8, version = version + 1
+        WHERE slug = $9 AND version = $10
+        AND ((user_id = $11 AND org_id IS NULL) OR edit_secret_hash = $12
+            OR EXISTS(SELECT 1 FROM text_shares WHERE text_id = texts.id AND user_id = $11 AND permission = 'edit')
+            OR EXISTS(SELECT 1 FROM organization_members WHERE org_id = texts.org_id AND user_id = $11 AND role IN ('owner', 'admin', 'member')))
+        AND ((user_id = $11 AND org_id IS NULL)
+            OR EXISTS(SELECT 1 FROM organization_members WHERE org_id = texts.org_id AND user_id = $11 AND role IN ('owner', 'admin'))
+            OR (expires IS NOT DISTINCT FROM $4 AND visibility = $5 AND burn_after_read = $7 AND access_password_hash IS NOT DISTINCT FROM $8))
         RETURNING version
     `
 	args := []interface{}{
@@ -224,17 +736,26 @@ func (m TextModel) Update(text *Text, userID int64) error {
 		text.Content,
 		text.Format,
 		text.Expires,
-		text.IsPrivate,
+		text.Visibility,
 		text.EncryptionSalt,
+		text.BurnAfterRead,
+		text.Password.hash,
 		text.Slug,
 		text.Version,
 		userID,
+		hashEditSecret(editSecret),
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&text.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&text.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -243,23 +764,32 @@ func (m TextModel) Update(text *Text, userID int64) error {
 			return err
 		}
 	}
-	return nil
+
+	// Keep a copy of the new content so earlier versions are never lost
+	err = insertRevision(ctx, tx, text, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// Delete will remove a specific record from the texts table based on the id
-// Delete will remove a specific record from the texts table based on the id
-func (m TextModel) Delete(slug string, userID int64) error {
+// Delete will remove a specific record from the texts table based on the id. The same users that
+// DeletableBy allows may delete the text, userID being nil for anonymous users.
+func (m TextModel) Delete(slug string, userID *int64, editSecret string) error {
 	if slug == "" {
 		return ErrRecordNotFound
 	}
 	query := `
         DELETE FROM texts
-        WHERE slug = $1 AND (user_id = $2 OR user_id IS NULL)
+        WHERE slug = $1
+        AND ((user_id = $2 AND org_id IS NULL) OR edit_secret_hash = $3
+            OR EXISTS(SELECT 1 FROM organization_members WHERE org_id = texts.org_id AND user_id = $2 AND role IN ('owner', 'admin')))
     `
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, slug, userID)
+	result, err := m.DB.ExecContext(ctx, query, slug, userID, hashEditSecret(editSecret))
 	if err != nil {
 		return err
 	}
@@ -272,3 +802,45 @@ func (m TextModel) Delete(slug string, userID int64) error {
 	}
 	return nil
 }
+
+// DeleteExpired permanently removes up to batchSize texts whose expiry time has passed and
+// returns the number of texts deleted. Their likes, comments and revisions are removed by
+// the ON DELETE CASCADE constraints.
+func (m TextModel) DeleteExpired(batchSize int) (int64, error) {
+	query := `
+        DELETE FROM texts
+        WHERE id IN (
+            SELECT id FROM texts
+            WHERE expires IS NOT NULL AND expires <= NOW()
+            ORDER BY expires
+            LIMIT $1
+        )`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// DeleteBurnedBefore forgets the burned texts that were read before the cutoff, and returns how many were
+// removed. Their slugs may be handed out again, and are reported as not found rather than burned.
+func (m TextModel) DeleteBurnedBefore(cutoff time.Time) (int64, error) {
+	query := `
+        DELETE FROM burned_texts
+        WHERE burned_at < $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
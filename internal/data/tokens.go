@@ -6,6 +6,8 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
+	"strings"
 	"time"
 
 	"dev.theenthusiast.text-bin/internal/validator"
@@ -15,14 +17,54 @@ const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
 	ScopePasswordReset  = "password-reset"
+	ScopeTextAccess     = "text-access"
+	ScopeShareLink      = "share-link"
+	ScopeRefresh        = "refresh"
 )
 
+// ErrTokenReused is returned when a refresh token that was already exchanged is presented again
+var ErrTokenReused = errors.New("refresh token reused")
+
+// sessionTouchInterval is how stale the last use of a session may get before it is updated, so
+// that a busy client doesn't cause a write on every request
+const sessionTouchInterval = time.Minute
+
 type Token struct {
+	ID        int64     `json:"-"`
 	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
+	TextID    *int64    `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	MaxViews  *int32    `json:"-"`
+	UserAgent string    `json:"-"`
+	IP        string    `json:"-"`
+	FamilyID  *int64    `json:"-"`
+}
+
+// Session is an authentication token as its user sees it when listing where they are logged in.
+// The plaintext token is only known when logging in.
+type Session struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	Expiry     time.Time  `json:"expiry"`
+	Current    bool       `json:"current"`
+}
+
+// ShareLink is a token that lets anyone holding it read a single text, whatever its visibility.
+// The plaintext token is only known when the link is created.
+type ShareLink struct {
+	ID       int64     `json:"id"`
+	Token    string    `json:"token,omitempty"`
+	URL      string    `json:"url,omitempty"`
+	TextID   int64     `json:"text_id"`
+	Expiry   time.Time `json:"expiry"`
+	MaxViews *int32    `json:"max_views"`
+	Views    int32     `json:"views"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -63,16 +105,424 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewForText() method generates a new token that grants access to a single text rather than
+// belonging to a user, and inserts it into the tokens table.
+func (m TokenModel) NewForText(textID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(0, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	token.TextID = &textID
+	err = m.Insert(token)
+	return token, err
+}
+
 func (m TokenModel) Insert(token *Token) error {
+	// Tokens for a text have no user, which is stored as NULL rather than the zero ID
 	query := `
-		INSERT INTO tokens (hash, user_id, expiry, scope)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO tokens (hash, user_id, text_id, expiry, scope, max_views, user_agent, ip)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, $7, $8)
+		RETURNING id
 	`
-	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []interface{}{token.Hash, token.UserID, token.TextID, token.Expiry, token.Scope, token.MaxViews, token.UserAgent, token.IP}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&token.ID)
+}
+
+// NewSession() method logs a user in, generating a short-lived authentication token and the refresh token
+// that renews it. Both record the client that logged in with them, and start a new token family. A zero
+// accessTTL only generates the refresh token, for when authentication tokens are signed tokens instead.
+func (m TokenModel) NewSession(userID int64, accessTTL, refreshTTL time.Duration, userAgent, ip string) (*Token, *Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	refreshToken, err := generateSessionToken(userID, refreshTTL, ScopeRefresh, userAgent, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = insertSessionToken(ctx, tx, refreshToken, now, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if accessTTL == 0 {
+		return nil, refreshToken, tx.Commit()
+	}
+
+	accessToken, err := generateSessionToken(userID, accessTTL, ScopeAuthentication, userAgent, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	accessToken.FamilyID = &refreshToken.ID
+	err = insertSessionToken(ctx, tx, accessToken, now, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return accessToken, refreshToken, tx.Commit()
+}
+
+// RotateSession() method exchanges a refresh token for a new authentication token and refresh token of the same family.
+// The refresh token can't be used again, and presenting it again anyway revokes the whole family, as either the
+// client or someone who stole the token is using it out of turn; ErrTokenReused is returned then. As with
+// NewSession(), a zero accessTTL only generates the refresh token.
+func (m TokenModel) RotateSession(refreshPlaintext string, accessTTL, refreshTTL time.Duration, userAgent, ip string) (*Token, *Token, error) {
+	refreshHash := sha256.Sum256([]byte(refreshPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE tokens SET used_at = NOW()
+		WHERE hash = $1 AND scope = $2 AND expiry > $3 AND used_at IS NULL
+		RETURNING user_id, COALESCE(family_id, id), created_at
+	`
+	var userID, familyID int64
+	var createdAt time.Time
+	err = tx.QueryRowContext(ctx, query, refreshHash[:], ScopeRefresh, time.Now()).Scan(&userID, &familyID, &createdAt)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, err
+		}
+
+		query = `
+			SELECT COALESCE(family_id, id)
+			FROM tokens
+			WHERE hash = $1 AND scope = $2 AND used_at IS NOT NULL
+		`
+		err = tx.QueryRowContext(ctx, query, refreshHash[:], ScopeRefresh).Scan(&familyID)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return nil, nil, ErrRecordNotFound
+			default:
+				return nil, nil, err
+			}
+		}
+
+		query = `
+			WITH deleted AS (
+				DELETE FROM tokens
+				WHERE family_id = $1 OR id = $1
+				RETURNING expiry
+			)
+			INSERT INTO revoked_sessions (session_id, expiry)
+			SELECT $1, MAX(expiry) FROM deleted
+			HAVING COUNT(*) > 0
+			ON CONFLICT (session_id) DO UPDATE SET expiry = GREATEST(revoked_sessions.expiry, EXCLUDED.expiry)
+		`
+		_, err = tx.ExecContext(ctx, query, familyID)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrTokenReused
+	}
+
+	// The authentication tokens issued before are replaced by the new one
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family_id = $1 AND scope = $2`, familyID, ScopeAuthentication)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The new tokens keep the time of the login, so the session is still listed as created then
+	now := time.Now()
+
+	refreshToken, err := generateSessionToken(userID, refreshTTL, ScopeRefresh, userAgent, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	refreshToken.FamilyID = &familyID
+	err = insertSessionToken(ctx, tx, refreshToken, createdAt, &now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if accessTTL == 0 {
+		return nil, refreshToken, tx.Commit()
+	}
+
+	accessToken, err := generateSessionToken(userID, accessTTL, ScopeAuthentication, userAgent, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	accessToken.FamilyID = &familyID
+	err = insertSessionToken(ctx, tx, accessToken, createdAt, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return accessToken, refreshToken, tx.Commit()
+}
+
+// generateSessionToken generates a token that belongs to a session, recording the client it was issued to.
+// Overly long user agents are cut short, as they are only kept to tell sessions apart.
+func generateSessionToken(userID int64, ttl time.Duration, scope, userAgent, ip string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	token.UserAgent = strings.ToValidUTF8(userAgent, "")
+	token.IP = ip
+	return token, nil
+}
+
+// insertSessionToken inserts a token that belongs to a session within the transaction
+func insertSessionToken(ctx context.Context, tx *sql.Tx, token *Token, createdAt time.Time, lastUsedAt *time.Time) error {
+	query := `
+		INSERT INTO tokens (hash, user_id, expiry, scope, family_id, user_agent, ip, created_at, last_used_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`
+	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, token.FamilyID, token.UserAgent, token.IP, createdAt, lastUsedAt}
+	return tx.QueryRowContext(ctx, query, args...).Scan(&token.ID)
+}
+
+// GetAllSessionsForUser() method returns the sessions of a user that haven't expired, most recently created first.
+// A session is a token family, or an authentication token from before refresh tokens. The session with currentID is
+// marked as the current one.
+func (m TokenModel) GetAllSessionsForUser(userID, currentID int64) ([]*Session, error) {
+	query := `
+		SELECT COALESCE(family_id, id) AS session_id, MIN(created_at), MAX(last_used_at),
+		       (array_agg(user_agent ORDER BY id DESC))[1], (array_agg(ip ORDER BY id DESC))[1], MAX(expiry)
+		FROM tokens
+		WHERE scope IN ($1, $2) AND user_id = $3 AND expiry > $4 AND used_at IS NULL
+		GROUP BY session_id
+		ORDER BY MIN(created_at) DESC, session_id DESC
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, ScopeAuthentication, ScopeRefresh, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(&session.ID, &session.CreatedAt, &session.LastUsedAt, &session.UserAgent, &session.IP, &session.Expiry)
+		if err != nil {
+			return nil, err
+		}
+		session.Current = session.ID == currentID
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DeleteSession() method revokes a session of a user, along with every token of its family. The session
+// is added to the revoked sessions until its last token would have expired, so that signed tokens
+// issued for it are refused as well.
+func (m TokenModel) DeleteSession(id, userID int64) error {
+	query := `
+		WITH deleted AS (
+			DELETE FROM tokens
+			WHERE (id = $1 OR family_id = $1) AND scope IN ($2, $3) AND user_id = $4
+			RETURNING expiry
+		)
+		INSERT INTO revoked_sessions (session_id, expiry)
+		SELECT $1, MAX(expiry) FROM deleted
+		HAVING COUNT(*) > 0
+		ON CONFLICT (session_id) DO UPDATE SET expiry = GREATEST(revoked_sessions.expiry, EXCLUDED.expiry)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, ScopeAuthentication, ScopeRefresh, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteOtherSessions() method revokes all sessions of a user except the one with currentID, and returns how many were revoked.
+// Like DeleteSession(), it adds the sessions to the revoked sessions.
+func (m TokenModel) DeleteOtherSessions(userID, currentID int64) (int64, error) {
+	query := `
+		WITH deleted AS (
+			DELETE FROM tokens
+			WHERE scope IN ($1, $2) AND user_id = $3 AND COALESCE(family_id, id) <> $4
+			RETURNING COALESCE(family_id, id) AS session_id, expiry, used_at
+		), revoked AS (
+			INSERT INTO revoked_sessions (session_id, expiry)
+			SELECT session_id, MAX(expiry) FROM deleted
+			GROUP BY session_id
+			HAVING MAX(expiry) > NOW()
+			ON CONFLICT (session_id) DO UPDATE SET expiry = GREATEST(revoked_sessions.expiry, EXCLUDED.expiry)
+		)
+		SELECT COUNT(DISTINCT session_id) FROM deleted WHERE used_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var revoked int64
+	err := m.DB.QueryRowContext(ctx, query, ScopeAuthentication, ScopeRefresh, userID, currentID).Scan(&revoked)
+	return revoked, err
+}
+
+// GetAllRevokedSessions() method returns the IDs of the revoked sessions whose tokens haven't expired yet,
+// along with the time after which they don't need to be remembered anymore
+func (m TokenModel) GetAllRevokedSessions() (map[int64]time.Time, error) {
+	query := `
+		SELECT session_id, expiry
+		FROM revoked_sessions
+		WHERE expiry > $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revoked := make(map[int64]time.Time)
+	for rows.Next() {
+		var sessionID int64
+		var expiry time.Time
+		err := rows.Scan(&sessionID, &expiry)
+		if err != nil {
+			return nil, err
+		}
+		revoked[sessionID] = expiry
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return revoked, nil
+}
+
+// NewShareLink() method generates a share link for a text, owned by the user who created it.
+// A nil maxViews means the link can be used any number of times until it expires.
+func (m TokenModel) NewShareLink(userID, textID int64, ttl time.Duration, maxViews *int32) (*ShareLink, error) {
+	token, err := generateToken(userID, ttl, ScopeShareLink)
+	if err != nil {
+		return nil, err
+	}
+	token.TextID = &textID
+	token.MaxViews = maxViews
+	err = m.Insert(token)
+	if err != nil {
+		return nil, err
+	}
+	link := &ShareLink{
+		ID:       token.ID,
+		Token:    token.Plaintext,
+		TextID:   textID,
+		Expiry:   token.Expiry,
+		MaxViews: maxViews,
+	}
+	return link, nil
+}
+
+// GetAllShareLinksForText() method returns the share links of a text that can still be used, soonest to expire first
+func (m TokenModel) GetAllShareLinksForText(textID int64) ([]*ShareLink, error) {
+	query := `
+		SELECT id, text_id, expiry, max_views, views
+		FROM tokens
+		WHERE scope = $1 AND text_id = $2 AND expiry > $3
+		AND (max_views IS NULL OR views < max_views)
+		ORDER BY expiry, id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, ScopeShareLink, textID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []*ShareLink{}
+	for rows.Next() {
+		var link ShareLink
+		err := rows.Scan(&link.ID, &link.TextID, &link.Expiry, &link.MaxViews, &link.Views)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, &link)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// DeleteShareLink() method revokes a share link of a text
+func (m TokenModel) DeleteShareLink(id, textID int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE id = $1 AND scope = $2 AND text_id = $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, ScopeShareLink, textID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// ValidForText() method reports whether the plaintext token has the given scope, belongs to the text and has not expired
+func (m TokenModel) ValidForText(scope, tokenPlaintext string, textID int64) (bool, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM tokens
+			WHERE hash = $1 AND scope = $2 AND text_id = $3 AND expiry > $4
+		)
+	`
+	var valid bool
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], scope, textID, time.Now()).Scan(&valid)
+	return valid, err
+}
+
+// ValidateShareLink checks that a new share link expires within a year and allows at least one view
+func ValidateShareLink(v *validator.Validator, link *ShareLink) {
+	v.Check(link.Expiry.After(time.Now()), "expires", "must be greater than the current time")
+	v.Check(!link.Expiry.After(time.Now().AddDate(1, 0, 0)), "expires", "must not be more than 1 year in the future")
+	if link.MaxViews != nil {
+		v.Check(*link.MaxViews > 0, "max_views", "must be greater than zero")
+		v.Check(*link.MaxViews <= 1_000_000, "max_views", "must not be more than 1000000")
+	}
 }
 
 // DeleteAllForUser() method deletes all tokens for a specific user and scope
@@ -86,3 +536,23 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// DeleteExpired() method deletes all tokens whose expiry time has passed and returns how many were removed.
+// Revoked sessions whose tokens would have expired by now are forgotten as well.
+func (m TokenModel) DeleteExpired() (int64, error) {
+	query := `
+		WITH forgotten AS (
+			DELETE FROM revoked_sessions
+			WHERE expiry <= NOW()
+		)
+		DELETE FROM tokens
+		WHERE expiry <= NOW()
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
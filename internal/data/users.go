@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"dev.theenthusiast.text-bin/internal/validator"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -100,13 +101,22 @@ type UserModel struct {
 	DB *sql.DB
 }
 
+// Insert adds a new user, granting them the DefaultPermissions in the same statement so an account is
+// never left without them
 func (m UserModel) Insert(user *User) error {
 	query := `
-		INSERT INTO users (name, email, password_hash, activated)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, version`
+		WITH new_user AS (
+			INSERT INTO users (name, email, password_hash, activated)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at, version
+		), granted AS (
+			INSERT INTO users_permissions (user_id, permission_id)
+			SELECT new_user.id, permissions.id FROM new_user, permissions
+			WHERE permissions.code = ANY($5)
+		)
+		SELECT id, created_at, version FROM new_user`
 
-	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated}
+	args := []interface{}{user.Name, user.Email, user.Password.hash, user.Activated, pq.Array(DefaultPermissions)}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -156,7 +166,8 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	textsQuery := `
         SELECT id, created_at, title, content, format, expires, slug, version
         FROM texts
-        WHERE user_id = $1`
+        WHERE user_id = $1
+        AND (expires IS NULL OR expires > NOW())`
 
 	textsRows, err := m.DB.QueryContext(ctx, textsQuery, user.ID)
 	if err != nil {
@@ -279,11 +290,106 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	return &user, nil
 }
 
-// DeleteUser deletes a user and all associated data
+// GetForSession returns the user an authentication token belongs to, along with the ID of its session
+// so the session can be told apart from the other sessions of the user. The last use of the session
+// is recorded in the same statement, at most once every sessionTouchInterval.
+func (m UserModel) GetForSession(tokenPlaintext string) (*User, int64, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		WITH touched AS (
+			UPDATE tokens SET last_used_at = NOW()
+			WHERE hash = $1 AND scope = $2 AND expiry > $3
+			AND (last_used_at IS NULL OR last_used_at < $4)
+		)
+		SELECT u.id, u.created_at, u.name, u.email, u.password_hash, u.activated, u.version, COALESCE(t.family_id, t.id)
+		FROM users u
+		JOIN tokens t ON u.id = t.user_id
+		WHERE t.hash = $1 AND t.scope = $2 AND t.expiry > $3`
+
+	now := time.Now()
+	args := []interface{}{tokenHash[:], ScopeAuthentication, now, now.Add(-sessionTouchInterval)}
+	var user User
+	var sessionID int64
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&sessionID,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, 0, ErrRecordNotFound
+		default:
+			return nil, 0, err
+		}
+	}
+	return &user, sessionID, nil
+}
+
+// DeleteUser deletes a user and all associated data. The sessions of the user are added to the revoked
+// sessions, so that signed tokens issued to them are refused as well. ErrLastOwner is returned when the
+// user is the only owner of an organization, which has to be given another owner first.
 func (m UserModel) DeleteUser(id int64) error {
-	query := `DELETE FROM users WHERE id = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The memberships are deleted along with the user, so each organization they own must keep another owner
+	query := `
+		SELECT org_id FROM organization_members
+		WHERE user_id = $1 AND role = $2`
+
+	rows, err := tx.QueryContext(ctx, query, id, RoleOwner)
+	if err != nil {
+		return err
+	}
+	var orgIDs []int64
+	for rows.Next() {
+		var orgID int64
+		err := rows.Scan(&orgID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		orgIDs = append(orgIDs, orgID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, orgID := range orgIDs {
+		err = keepOwner(ctx, tx, orgID, id)
+		if err != nil {
+			return err
+		}
+	}
 
-	result, err := m.DB.Exec(query, id)
+	query = `
+		WITH revoked AS (
+			INSERT INTO revoked_sessions (session_id, expiry)
+			SELECT COALESCE(family_id, id), MAX(expiry) FROM tokens
+			WHERE user_id = $1 AND scope IN ($2, $3) AND expiry > NOW()
+			GROUP BY COALESCE(family_id, id)
+			ON CONFLICT (session_id) DO UPDATE SET expiry = GREATEST(revoked_sessions.expiry, EXCLUDED.expiry)
+		)
+		DELETE FROM users WHERE id = $1`
+
+	result, err := tx.ExecContext(ctx, query, id, ScopeAuthentication, ScopeRefresh)
 	if err != nil {
 		return err
 	}
@@ -297,5 +403,5 @@ func (m UserModel) DeleteUser(id int64) error {
 		return ErrRecordNotFound
 	}
 
-	return nil
+	return tx.Commit()
 }
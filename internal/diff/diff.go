@@ -0,0 +1,297 @@
+// Package diff computes line-based differences between two texts using Myers'
+// O(ND) algorithm and renders them as hunks or in the unified diff format.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op describes what happened to a line when going from the old text to the new one
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Delete Op = "delete"
+	Insert Op = "insert"
+)
+
+// maxEditDistance bounds the search for the middle snake of a single region. Regions that
+// differ by more than this are reported as a plain delete of the old lines followed by an
+// insert of the new ones, which keeps the running time predictable for very large inputs.
+const maxEditDistance = 4096
+
+// Edit is a single line of a diff together with the operation applied to it
+type Edit struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Hunk is a group of changed lines with surrounding context, as shown in a unified diff.
+// Line numbers are 1-based; a start of 0 means the hunk has no lines on that side.
+type Hunk struct {
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Lines    []Edit `json:"lines"`
+}
+
+// Lines returns the shortest sequence of edits that turns the lines of a into the lines of b
+func Lines(a, b string) []Edit {
+	d := &differ{a: splitLines(a), b: splitLines(b)}
+	d.compare(0, len(d.a), 0, len(d.b))
+	return d.edits
+}
+
+// Hunks groups the edits into hunks, keeping up to context unchanged lines around each change.
+// Changes separated by no more than twice the context are merged into a single hunk.
+func Hunks(edits []Edit, context int) []Hunk {
+	include := make([]bool, len(edits))
+	for i, e := range edits {
+		if e.Op == Equal {
+			continue
+		}
+		for j := max(0, i-context); j <= min(len(edits)-1, i+context); j++ {
+			include[j] = true
+		}
+	}
+
+	hunks := []Hunk{}
+	var current *Hunk
+	oldLine, newLine := 0, 0
+
+	for i, e := range edits {
+		if include[i] {
+			if current == nil {
+				current = &Hunk{OldStart: oldLine + 1, NewStart: newLine + 1}
+			}
+			current.Lines = append(current.Lines, e)
+		} else if current != nil {
+			hunks = append(hunks, *current)
+			current = nil
+		}
+
+		switch e.Op {
+		case Equal:
+			oldLine++
+			newLine++
+			if current != nil {
+				current.OldLines++
+				current.NewLines++
+			}
+		case Delete:
+			oldLine++
+			if current != nil {
+				current.OldLines++
+			}
+		case Insert:
+			newLine++
+			if current != nil {
+				current.NewLines++
+			}
+		}
+	}
+	if current != nil {
+		hunks = append(hunks, *current)
+	}
+
+	// An empty side of a hunk is addressed by the line just before it
+	for i := range hunks {
+		if hunks[i].OldLines == 0 {
+			hunks[i].OldStart--
+		}
+		if hunks[i].NewLines == 0 {
+			hunks[i].NewStart--
+		}
+	}
+
+	return hunks
+}
+
+// Unified renders the hunks in the unified diff format, using fromName and toName in the file headers.
+// It returns an empty string when there are no hunks.
+func Unified(fromName, toName string, hunks []Hunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	for _, h := range hunks {
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", formatRange(h.OldStart, h.OldLines), formatRange(h.NewStart, h.NewLines))
+		for _, line := range h.Lines {
+			switch line.Op {
+			case Equal:
+				sb.WriteByte(' ')
+			case Delete:
+				sb.WriteByte('-')
+			case Insert:
+				sb.WriteByte('+')
+			}
+			sb.WriteString(line.Text)
+			sb.WriteByte('\n')
+		}
+	}
+
+	return sb.String()
+}
+
+func formatRange(start, lines int) string {
+	if lines == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// splitLines splits s into lines without their line endings. A trailing newline does not
+// produce an extra empty line.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+type differ struct {
+	a, b  []string
+	edits []Edit
+}
+
+func (d *differ) emit(op Op, lines []string) {
+	for _, line := range lines {
+		d.edits = append(d.edits, Edit{Op: op, Text: line})
+	}
+}
+
+// compare appends the edits for a[aLo:aHi] and b[bLo:bHi]. Common prefixes and suffixes are
+// stripped first, and what is left is split around a middle snake and compared recursively.
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	prefix := aLo
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	d.emit(Equal, d.a[prefix:aLo])
+
+	suffix := aHi
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	switch {
+	case aLo == aHi:
+		d.emit(Insert, d.b[bLo:bHi])
+	case bLo == bHi:
+		d.emit(Delete, d.a[aLo:aHi])
+	default:
+		x, y, ok := d.bisect(aLo, aHi, bLo, bHi)
+		if ok {
+			d.compare(aLo, x, bLo, y)
+			d.compare(x, aHi, y, bHi)
+		} else {
+			d.emit(Delete, d.a[aLo:aHi])
+			d.emit(Insert, d.b[bLo:bHi])
+		}
+	}
+
+	d.emit(Equal, d.a[aHi:suffix])
+}
+
+// bisect runs the forward and reverse searches of Myers' algorithm at the same time until they
+// overlap, and returns the point where they meet. Both regions must be non-empty and must not
+// share a common prefix or suffix, which guarantees the split makes progress on both sides.
+func (d *differ) bisect(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	// The searches give up after maxEditDistance steps, so the diagonals they can reach and the
+	// memory they need are bounded by it rather than by the size of the regions
+	maxD := min((n+m+1)/2, maxEditDistance)
+	offset := maxD
+	length := 2*maxD + 2
+
+	// vf[k] and vr[k] hold the furthest reaching x on diagonal k for the forward and reverse
+	// searches. The reverse search measures x and y from the end of each region.
+	vf := make([]int, length)
+	vr := make([]int, length)
+	for i := range vf {
+		vf[i] = -1
+		vr[i] = -1
+	}
+	vf[offset+1] = 0
+	vr[offset+1] = 0
+
+	delta := n - m
+	// If the total number of lines is odd, the searches meet during a forward step.
+	front := delta%2 != 0
+
+	var kfStart, kfEnd, krStart, krEnd int
+
+	for step := 0; step < maxD; step++ {
+		for k := -step + kfStart; k <= step-kfEnd; k += 2 {
+			kOffset := offset + k
+			var x int
+			if k == -step || (k != step && vf[kOffset-1] < vf[kOffset+1]) {
+				x = vf[kOffset+1]
+			} else {
+				x = vf[kOffset-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[kOffset] = x
+
+			switch {
+			case x > n:
+				// Ran off the right of the grid
+				kfEnd += 2
+			case y > m:
+				// Ran off the bottom of the grid
+				kfStart += 2
+			case front:
+				rOffset := offset + delta - k
+				if rOffset >= 0 && rOffset < length && vr[rOffset] != -1 && x >= n-vr[rOffset] {
+					return aLo + x, bLo + y, true
+				}
+			}
+		}
+
+		for k := -step + krStart; k <= step-krEnd; k += 2 {
+			kOffset := offset + k
+			var x int
+			if k == -step || (k != step && vr[kOffset-1] < vr[kOffset+1]) {
+				x = vr[kOffset+1]
+			} else {
+				x = vr[kOffset-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			vr[kOffset] = x
+
+			switch {
+			case x > n:
+				krEnd += 2
+			case y > m:
+				krStart += 2
+			case !front:
+				fOffset := offset + delta - k
+				if fOffset >= 0 && fOffset < length && vf[fOffset] != -1 {
+					fx := vf[fOffset]
+					fy := fx - (delta - k)
+					if fx >= n-x {
+						return aLo + fx, bLo + fy, true
+					}
+				}
+			}
+		}
+	}
+
+	return 0, 0, false
+}
@@ -0,0 +1,303 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Edit
+	}{
+		{
+			name: "BothEmpty",
+			a:    "",
+			b:    "",
+			want: nil,
+		},
+		{
+			name: "EmptyOld",
+			a:    "",
+			b:    "one\ntwo\n",
+			want: []Edit{{Insert, "one"}, {Insert, "two"}},
+		},
+		{
+			name: "EmptyNew",
+			a:    "one\ntwo\n",
+			b:    "",
+			want: []Edit{{Delete, "one"}, {Delete, "two"}},
+		},
+		{
+			name: "Unchanged",
+			a:    "one\ntwo\n",
+			b:    "one\ntwo\n",
+			want: []Edit{{Equal, "one"}, {Equal, "two"}},
+		},
+		{
+			name: "PureInsert",
+			a:    "one\nthree\n",
+			b:    "one\ntwo\nthree\n",
+			want: []Edit{{Equal, "one"}, {Insert, "two"}, {Equal, "three"}},
+		},
+		{
+			name: "PureDelete",
+			a:    "one\ntwo\nthree\n",
+			b:    "one\nthree\n",
+			want: []Edit{{Equal, "one"}, {Delete, "two"}, {Equal, "three"}},
+		},
+		{
+			name: "Replace",
+			a:    "one\ntwo\nthree\n",
+			b:    "one\n2\nthree\n",
+			want: []Edit{{Equal, "one"}, {Delete, "two"}, {Insert, "2"}, {Equal, "three"}},
+		},
+		{
+			name: "CRLF",
+			a:    "one\r\ntwo\r\n",
+			b:    "one\ntwo\nthree\n",
+			want: []Edit{{Equal, "one"}, {Equal, "two"}, {Insert, "three"}},
+		},
+		{
+			name: "MissingFinalNewline",
+			a:    "one\ntwo",
+			b:    "one\ntwo\n",
+			want: []Edit{{Equal, "one"}, {Equal, "two"}},
+		},
+		{
+			name: "InterleavedChanges",
+			a:    "a\nb\nc\nd\ne\n",
+			b:    "a\nc\nd\nx\ne\n",
+			want: []Edit{{Equal, "a"}, {Delete, "b"}, {Equal, "c"}, {Equal, "d"}, {Insert, "x"}, {Equal, "e"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines(%q, %q) = %v; want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLinesShortest checks that the edits turn the old lines into the new ones, and that no more
+// lines are changed than the length of the longest common subsequence allows
+func TestLinesShortest(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"Shuffled", "a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n"},
+		{"Repeated", strings.Repeat("x\ny\n", 20), strings.Repeat("y\nx\n", 20)},
+		{"Disjoint", "a\nb\nc\n", "d\ne\nf\ng\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := splitLines(tt.a), splitLines(tt.b)
+			edits := Lines(tt.a, tt.b)
+
+			var gotA, gotB []string
+			changed := 0
+			for _, e := range edits {
+				if e.Op != Insert {
+					gotA = append(gotA, e.Text)
+				}
+				if e.Op != Delete {
+					gotB = append(gotB, e.Text)
+				}
+				if e.Op != Equal {
+					changed++
+				}
+			}
+			if !reflect.DeepEqual(gotA, a) || !reflect.DeepEqual(gotB, b) {
+				t.Fatalf("edits %v don't turn %q into %q", edits, tt.a, tt.b)
+			}
+
+			if want := len(a) + len(b) - 2*lcs(a, b); changed != want {
+				t.Errorf("%d lines changed; want %d", changed, want)
+			}
+		})
+	}
+}
+
+// lcs returns the length of the longest common subsequence of a and b
+func lcs(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func TestHunks(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    []Hunk
+	}{
+		{
+			name:    "Unchanged",
+			a:       "one\ntwo\n",
+			b:       "one\ntwo\n",
+			context: 3,
+			want:    []Hunk{},
+		},
+		{
+			name:    "EmptyOld",
+			a:       "",
+			b:       "one\ntwo\nthree\n",
+			context: 3,
+			want: []Hunk{
+				{OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 3, Lines: []Edit{{Insert, "one"}, {Insert, "two"}, {Insert, "three"}}},
+			},
+		},
+		{
+			name:    "EmptyNew",
+			a:       "one\ntwo\n",
+			b:       "",
+			context: 3,
+			want: []Hunk{
+				{OldStart: 1, OldLines: 2, NewStart: 0, NewLines: 0, Lines: []Edit{{Delete, "one"}, {Delete, "two"}}},
+			},
+		},
+		{
+			name:    "InsertWithoutContext",
+			a:       "1\n2\n3\n",
+			b:       "1\n2\nnew\n3\n",
+			context: 0,
+			want: []Hunk{
+				{OldStart: 2, OldLines: 0, NewStart: 3, NewLines: 1, Lines: []Edit{{Insert, "new"}}},
+			},
+		},
+		{
+			name:    "DeleteWithContext",
+			a:       "1\n2\n3\n4\n5\n6\n7\n8\n",
+			b:       "1\n2\n3\n4\n6\n7\n8\n",
+			context: 1,
+			want: []Hunk{
+				{OldStart: 4, OldLines: 3, NewStart: 4, NewLines: 2, Lines: []Edit{{Equal, "4"}, {Delete, "5"}, {Equal, "6"}}},
+			},
+		},
+		{
+			// Two unchanged lines between the changes, no more than twice the context
+			name:    "NearbyChangesMerged",
+			a:       "1\n2\n3\n4\n5\n6\n",
+			b:       "1\nX\n3\n4\nY\n6\n",
+			context: 1,
+			want: []Hunk{
+				{OldStart: 1, OldLines: 6, NewStart: 1, NewLines: 6, Lines: []Edit{
+					{Equal, "1"}, {Delete, "2"}, {Insert, "X"}, {Equal, "3"}, {Equal, "4"}, {Delete, "5"}, {Insert, "Y"}, {Equal, "6"},
+				}},
+			},
+		},
+		{
+			// Three unchanged lines between the changes, more than twice the context
+			name:    "DistantChangesSplit",
+			a:       "1\n2\n3\n4\n5\n6\n7\n",
+			b:       "1\nX\n3\n4\n5\nY\n7\n",
+			context: 1,
+			want: []Hunk{
+				{OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 3, Lines: []Edit{{Equal, "1"}, {Delete, "2"}, {Insert, "X"}, {Equal, "3"}}},
+				{OldStart: 5, OldLines: 3, NewStart: 5, NewLines: 3, Lines: []Edit{{Equal, "5"}, {Delete, "6"}, {Insert, "Y"}, {Equal, "7"}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Hunks(Lines(tt.a, tt.b), tt.context)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "Unchanged",
+			a:    "one\n",
+			b:    "one\n",
+			want: "",
+		},
+		{
+			name: "EmptyOld",
+			a:    "",
+			b:    "one\ntwo\nthree\n",
+			want: "--- a\n+++ b\n@@ -0,0 +1,3 @@\n+one\n+two\n+three\n",
+		},
+		{
+			name: "EmptyNew",
+			a:    "one\n",
+			b:    "",
+			want: "--- a\n+++ b\n@@ -1 +0,0 @@\n-one\n",
+		},
+		{
+			name: "SingleLineChange",
+			a:    "one\ntwo\nthree\n",
+			b:    "one\n2\nthree\n",
+			want: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n",
+		},
+		{
+			name: "CRLFAndMissingFinalNewline",
+			a:    "one\r\ntwo",
+			b:    "one\ntwo\nthree",
+			want: "--- a\n+++ b\n@@ -1,2 +1,3 @@\n one\n two\n+three\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified("a", "b", Hunks(Lines(tt.a, tt.b), 3))
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLinesMaxEditDistance checks that regions differing by more than maxEditDistance lines fall back
+// to a delete of the old lines followed by an insert of the new ones
+func TestLinesMaxEditDistance(t *testing.T) {
+	var a, b strings.Builder
+	for i := 0; i < maxEditDistance+1; i++ {
+		a.WriteString("a\n")
+		b.WriteString("b\n")
+	}
+
+	edits := Lines(a.String(), b.String())
+	if len(edits) != 2*(maxEditDistance+1) {
+		t.Fatalf("got %d edits; want %d", len(edits), 2*(maxEditDistance+1))
+	}
+	for i, e := range edits {
+		want := Delete
+		if i > maxEditDistance {
+			want = Insert
+		}
+		if e.Op != want {
+			t.Fatalf("edit %d is %s; want %s", i, e.Op, want)
+		}
+	}
+}
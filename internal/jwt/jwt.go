@@ -0,0 +1,196 @@
+// Package jwt issues and verifies JSON Web Tokens signed with HMAC-SHA256 (HS256).
+//
+// Several signing keys can be configured so they can be rotated: every token names the key it was
+// signed with in the kid header, new tokens are signed with the first key, and tokens signed with
+// any of the keys are accepted. A retired key can be removed once the tokens it signed have expired.
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// minSecretLength is the shortest secret accepted, the size of the HMAC-SHA256 output
+const minSecretLength = 32
+
+var (
+	ErrInvalidToken = errors.New("jwt: invalid token")
+	ErrExpiredToken = errors.New("jwt: token has expired")
+)
+
+// Key is a named secret used to sign tokens
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// ParseKeys parses signing keys written as comma separated id:secret pairs, such as
+// "2024-06:secret,2024-01:older-secret". The first key is the one new tokens are signed with.
+func ParseKeys(s string) ([]Key, error) {
+	var keys []Key
+	seen := make(map[string]bool)
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("jwt: key %q must be written as id:secret", pair)
+		}
+		if len(secret) < minSecretLength {
+			return nil, fmt.Errorf("jwt: the secret of key %q must be at least %d bytes long", id, minSecretLength)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("jwt: duplicate key id %q", id)
+		}
+		seen[id] = true
+
+		keys = append(keys, Key{ID: id, Secret: []byte(secret)})
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("jwt: at least one key is needed")
+	}
+
+	return keys, nil
+}
+
+// Claims are the registered claims used by the API, along with the details of the user that let
+// requests be authenticated without looking the user up
+type Claims struct {
+	Subject   int64  `json:"sub,string"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"jti"`
+	SessionID int64  `json:"sid"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Activated bool   `json:"activated"`
+	// Scope is the space separated list of the permission codes of the user
+	Scope string `json:"scope"`
+}
+
+// Scopes returns the permission codes in the scope claim
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// Signer signs tokens with its first key and verifies tokens signed with any of its keys
+type Signer struct {
+	keys    []Key
+	secrets map[string][]byte
+}
+
+func NewSigner(keys []Key) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("jwt: at least one key is needed")
+	}
+
+	secrets := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		secrets[key.ID] = key.Secret
+	}
+
+	return &Signer{keys: keys, secrets: secrets}, nil
+}
+
+// Sign returns the signed token for the claims. A random token ID is filled in when the claims
+// don't have one.
+func (s *Signer) Sign(claims Claims) (string, error) {
+	if claims.ID == "" {
+		randomBytes := make([]byte, 16)
+		_, err := rand.Read(randomBytes)
+		if err != nil {
+			return "", err
+		}
+		claims.ID = base64.RawURLEncoding.EncodeToString(randomBytes)
+	}
+
+	key := s.keys[0]
+
+	headerJSON, err := json.Marshal(header{Algorithm: "HS256", Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign(key.Secret, signingInput)), nil
+}
+
+// Verify checks the signature and expiry of a token and returns its claims. Only HS256 tokens
+// signed with one of the keys of the signer are accepted.
+func (s *Signer) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var h header
+	err = json.Unmarshal(headerJSON, &h)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if h.Algorithm != "HS256" {
+		return nil, ErrInvalidToken
+	}
+
+	secret, ok := s.secrets[h.KeyID]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal(signature, sign(secret, parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidToken
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	err = json.Unmarshal(claimsJSON, &claims)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	return &claims, nil
+}
+
+func sign(secret []byte, signingInput string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
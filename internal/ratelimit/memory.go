@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the buckets in memory, so they are only shared by limiters in the same process
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, interval, window time.Duration) (time.Duration, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	fullAt, ok := s.buckets[key]
+	if !ok || fullAt.Before(now) {
+		fullAt = now
+	}
+
+	next := fullAt.Add(interval)
+	if next.Sub(now) > window {
+		return next.Sub(now) - window, false, nil
+	}
+
+	s.buckets[key] = next
+	return 0, true, nil
+}
+
+func (s *MemoryStore) Cleanup(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, fullAt := range s.buckets {
+		if !fullAt.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+
+	return nil
+}
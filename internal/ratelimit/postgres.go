@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// PostgresStore keeps the buckets in the rate_limit_buckets table, so that every replica of the
+// API counts against the same buckets. The table is unlogged, as losing the buckets in a crash
+// only resets the limits.
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{DB: db}
+}
+
+// Take takes the token in a single statement, so the row lock taken by the upsert is all that
+// keeps concurrent requests for the same key from taking the same token. When the bucket is
+// empty, the upsert changes nothing and the second half of the query reports the wait instead.
+func (s *PostgresStore) Take(ctx context.Context, key string, interval, window time.Duration) (time.Duration, bool, error) {
+	query := `
+        WITH taken AS (
+            INSERT INTO rate_limit_buckets AS b (key, full_at)
+            VALUES ($1, NOW() + make_interval(secs => $2))
+            ON CONFLICT (key) DO UPDATE
+            SET full_at = GREATEST(b.full_at, NOW()) + make_interval(secs => $2)
+            WHERE GREATEST(b.full_at, NOW()) + make_interval(secs => $2) <= NOW() + make_interval(secs => $3)
+            RETURNING key
+        )
+        SELECT true, 0::double precision FROM taken
+        UNION ALL
+        SELECT false, EXTRACT(EPOCH FROM GREATEST(full_at, NOW()) + make_interval(secs => $2) - NOW() - make_interval(secs => $3))::double precision
+        FROM rate_limit_buckets
+        WHERE key = $1 AND NOT EXISTS (SELECT 1 FROM taken)`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	var allowed bool
+	var retryAfter float64
+
+	err := s.DB.QueryRowContext(ctx, query, key, interval.Seconds(), window.Seconds()).Scan(&allowed, &retryAfter)
+	if err != nil {
+		switch {
+		// Another request created the bucket after this statement started and took the only token,
+		// so the select can't see the bucket yet
+		case errors.Is(err, sql.ErrNoRows):
+			return interval, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+
+	return time.Duration(retryAfter * float64(time.Second)), allowed, nil
+}
+
+func (s *PostgresStore) Cleanup(ctx context.Context) error {
+	query := `
+        DELETE FROM rate_limit_buckets
+        WHERE full_at <= NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, query)
+	return err
+}
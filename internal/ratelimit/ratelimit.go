@@ -0,0 +1,47 @@
+// Package ratelimit implements token bucket rate limiting with pluggable stores for the buckets,
+// so that replicas of the API can share their counters through PostgreSQL.
+//
+// A bucket is tracked as the time at which it will be full again. Taking a token moves that time
+// one interval further, and a token can only be taken while the bucket is less than a window away
+// from being full, the window being the time it takes to refill the whole burst.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Store keeps the token buckets of one or more limiters
+type Store interface {
+	// Take takes a token from the bucket of the key, which gains a token every interval and holds
+	// window/interval tokens at most. When the bucket is empty, it reports how long until the next
+	// token is available instead.
+	Take(ctx context.Context, key string, interval, window time.Duration) (time.Duration, bool, error)
+
+	// Cleanup removes the buckets that are full again, as they are no different from a new bucket
+	Cleanup(ctx context.Context) error
+}
+
+// Limiter allows rps events per second for each key, with bursts of up to burst events
+type Limiter struct {
+	store    Store
+	interval time.Duration
+	window   time.Duration
+}
+
+// New returns a limiter that keeps its buckets in the store. The rate must be positive and the
+// burst at least 1.
+func New(store Store, rps float64, burst int) *Limiter {
+	interval := time.Duration(float64(time.Second) / rps)
+
+	return &Limiter{
+		store:    store,
+		interval: interval,
+		window:   interval * time.Duration(burst),
+	}
+}
+
+// Allow takes a token for the key. When none is available, it reports how long until one is.
+func (l *Limiter) Allow(ctx context.Context, key string) (time.Duration, bool, error) {
+	return l.store.Take(ctx, key, l.interval, l.window)
+}
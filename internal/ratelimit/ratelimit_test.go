@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// testStore runs the checks every store has to pass against a fresh key, so results of earlier
+// runs against a shared database don't get in the way.
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	prefix := fmt.Sprintf("test:%d:", time.Now().UnixNano())
+
+	t.Run("ConcurrentBurst", func(t *testing.T) {
+		// A slow refill, so only the burst can be taken during the test
+		limiter := New(store, 0.001, 10)
+		key := prefix + "burst"
+
+		var allowed atomic.Int64
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, ok, err := limiter.Allow(ctx, key)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if ok {
+					allowed.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if n := allowed.Load(); n != 10 {
+			t.Errorf("allowed %d requests; want 10", n)
+		}
+
+		retryAfter, ok, err := limiter.Allow(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			t.Fatal("allowed a request after the burst was used up")
+		}
+		if retryAfter <= 0 || retryAfter > 1000*time.Second {
+			t.Errorf("retry after %s; want between 0s and 1000s", retryAfter)
+		}
+	})
+
+	t.Run("ConcurrentKeys", func(t *testing.T) {
+		limiter := New(store, 0.001, 3)
+
+		var wg sync.WaitGroup
+		counts := make([]atomic.Int64, 5)
+		for k := range counts {
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(k int) {
+					defer wg.Done()
+					_, ok, err := limiter.Allow(ctx, fmt.Sprintf("%skeys:%d", prefix, k))
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if ok {
+						counts[k].Add(1)
+					}
+				}(k)
+			}
+		}
+		wg.Wait()
+
+		for k := range counts {
+			if n := counts[k].Load(); n != 3 {
+				t.Errorf("allowed %d requests for key %d; want 3", n, k)
+			}
+		}
+	})
+
+	t.Run("Refill", func(t *testing.T) {
+		limiter := New(store, 20, 1)
+		key := prefix + "refill"
+
+		_, ok, err := limiter.Allow(ctx, key)
+		if err != nil || !ok {
+			t.Fatalf("first request: allowed %t, error %v", ok, err)
+		}
+		retryAfter, ok, err := limiter.Allow(ctx, key)
+		if err != nil || ok {
+			t.Fatalf("second request: allowed %t, error %v", ok, err)
+		}
+
+		time.Sleep(retryAfter + 20*time.Millisecond)
+
+		_, ok, err = limiter.Allow(ctx, key)
+		if err != nil || !ok {
+			t.Fatalf("request after refill: allowed %t, error %v", ok, err)
+		}
+	})
+
+	t.Run("Cleanup", func(t *testing.T) {
+		limiter := New(store, 20, 2)
+		key := prefix + "cleanup"
+
+		for i := 0; i < 2; i++ {
+			_, _, err := limiter.Allow(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		time.Sleep(150 * time.Millisecond)
+
+		err := store.Cleanup(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The bucket is full again whether it was removed or not, so the whole burst is available
+		for i := 0; i < 2; i++ {
+			_, ok, err := limiter.Allow(ctx, key)
+			if err != nil || !ok {
+				t.Fatalf("request %d after cleanup: allowed %t, error %v", i+1, ok, err)
+			}
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	testStore(t, store)
+
+	time.Sleep(200 * time.Millisecond)
+	store.Cleanup(context.Background())
+
+	// Only the buckets with the slow refill are still waiting to be full again
+	if n := len(store.buckets); n != 6 {
+		t.Errorf("%d buckets left after cleanup; want 6", n)
+	}
+}
+
+// TestPostgresStore needs a database with the migrations applied, given in the TEST_DSN
+// environment variable.
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("TEST_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.SetMaxOpenConns(25)
+
+	err = db.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStore(t, NewPostgresStore(db))
+
+	_, err = db.Exec("DELETE FROM rate_limit_buckets WHERE key LIKE 'test:%'")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS texts_search_vector_idx;
+
+ALTER TABLE texts
+DROP COLUMN IF EXISTS search_vector;
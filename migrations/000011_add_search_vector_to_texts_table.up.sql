@@ -0,0 +1,7 @@
+ALTER TABLE texts
+ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(content, '')), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS texts_search_vector_idx ON texts USING GIN (search_vector);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS text_revisions (
+    id bigserial PRIMARY KEY,
+    text_id bigint NOT NULL REFERENCES texts ON DELETE CASCADE,
+    version integer NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    format text NOT NULL,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (text_id, version)
+);
+
+-- Record the current state of every existing text as its first known revision.
+INSERT INTO text_revisions (text_id, version, title, content, format, user_id, created_at)
+SELECT id, version, title, content, format, user_id, created_at
+FROM texts;
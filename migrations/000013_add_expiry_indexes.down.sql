@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS texts_expires_idx;
+DROP INDEX IF EXISTS tokens_expiry_idx;
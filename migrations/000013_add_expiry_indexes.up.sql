@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS texts_expires_idx ON texts (expires);
+CREATE INDEX IF NOT EXISTS tokens_expiry_idx ON tokens (expiry);
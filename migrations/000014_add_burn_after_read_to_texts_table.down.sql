@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS burned_texts;
+
+ALTER TABLE texts DROP COLUMN IF EXISTS burn_after_read;
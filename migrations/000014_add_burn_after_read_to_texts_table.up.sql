@@ -0,0 +1,8 @@
+ALTER TABLE texts ADD COLUMN burn_after_read BOOLEAN NOT NULL DEFAULT false;
+
+-- Slugs of burn after read texts that have been read, so later requests can tell
+-- a burned text apart from one that never existed.
+CREATE TABLE IF NOT EXISTS burned_texts (
+    slug text PRIMARY KEY,
+    burned_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
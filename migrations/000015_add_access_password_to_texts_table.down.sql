@@ -0,0 +1,5 @@
+DELETE FROM tokens WHERE user_id IS NULL;
+ALTER TABLE tokens ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE tokens DROP COLUMN IF EXISTS text_id;
+
+ALTER TABLE texts DROP COLUMN IF EXISTS access_password_hash;
@@ -0,0 +1,5 @@
+ALTER TABLE texts ADD COLUMN access_password_hash bytea;
+
+-- Access tokens for password protected texts belong to a text rather than a user
+ALTER TABLE tokens ADD COLUMN text_id bigint REFERENCES texts ON DELETE CASCADE;
+ALTER TABLE tokens ALTER COLUMN user_id DROP NOT NULL;
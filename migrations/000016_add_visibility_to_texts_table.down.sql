@@ -0,0 +1,6 @@
+ALTER TABLE texts ADD COLUMN is_private BOOLEAN NOT NULL DEFAULT false;
+
+-- Unlisted texts become public again, as there is nothing to map them to
+UPDATE texts SET is_private = true WHERE visibility = 'private';
+
+ALTER TABLE texts DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,7 @@
+ALTER TABLE texts ADD COLUMN visibility text NOT NULL DEFAULT 'public';
+
+UPDATE texts SET visibility = 'private' WHERE is_private;
+
+ALTER TABLE texts ADD CONSTRAINT texts_visibility_check CHECK (visibility IN ('public', 'unlisted', 'private'));
+
+ALTER TABLE texts DROP COLUMN IF EXISTS is_private;
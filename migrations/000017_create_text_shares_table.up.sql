@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS text_shares (
+    text_id bigint NOT NULL REFERENCES texts ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    permission text NOT NULL CHECK (permission IN ('read', 'edit')),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (text_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS text_shares_user_id_idx ON text_shares (user_id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS tokens_text_id_idx;
+
+DELETE FROM tokens WHERE scope = 'share-link';
+
+ALTER TABLE tokens DROP COLUMN IF EXISTS views;
+ALTER TABLE tokens DROP COLUMN IF EXISTS max_views;
+ALTER TABLE tokens DROP COLUMN IF EXISTS id;
@@ -0,0 +1,8 @@
+-- Share links are listed and revoked by id, as their plaintext token is only shown once
+ALTER TABLE tokens ADD COLUMN id bigserial;
+ALTER TABLE tokens ADD CONSTRAINT tokens_id_key UNIQUE (id);
+
+ALTER TABLE tokens ADD COLUMN max_views integer;
+ALTER TABLE tokens ADD COLUMN views integer NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS tokens_text_id_idx ON tokens (text_id);
@@ -0,0 +1,10 @@
+UPDATE texts SET visibility = 'private' WHERE visibility = 'org';
+ALTER TABLE texts DROP CONSTRAINT IF EXISTS texts_visibility_check;
+ALTER TABLE texts ADD CONSTRAINT texts_visibility_check CHECK (visibility IN ('public', 'unlisted', 'private'));
+
+DROP INDEX IF EXISTS texts_org_id_idx;
+ALTER TABLE texts DROP COLUMN IF EXISTS org_id;
+
+DROP TABLE IF EXISTS organization_invitations;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
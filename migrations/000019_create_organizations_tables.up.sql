@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+    org_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role text NOT NULL CHECK (role IN ('owner', 'admin', 'member', 'viewer')),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (org_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organization_members_user_id_idx ON organization_members (user_id);
+
+-- Invitations are addressed to an email, as the invited person may not have an account yet
+CREATE TABLE IF NOT EXISTS organization_invitations (
+    hash bytea PRIMARY KEY,
+    org_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+    email citext NOT NULL,
+    role text NOT NULL CHECK (role IN ('owner', 'admin', 'member', 'viewer')),
+    invited_by bigint REFERENCES users ON DELETE SET NULL,
+    expiry timestamp(0) with time zone NOT NULL
+);
+
+ALTER TABLE texts ADD COLUMN org_id bigint REFERENCES organizations ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS texts_org_id_idx ON texts (org_id);
+
+ALTER TABLE texts DROP CONSTRAINT IF EXISTS texts_visibility_check;
+ALTER TABLE texts ADD CONSTRAINT texts_visibility_check CHECK (visibility IN ('public', 'unlisted', 'private', 'org'));
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS permissions (
+    id bigserial PRIMARY KEY,
+    code text NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+INSERT INTO permissions (code)
+VALUES
+    ('texts:write'),
+    ('comments:write'),
+    ('comments:moderate'),
+    ('admin:users');
+
+-- Existing users get the permissions new users are granted when they register
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id FROM users, permissions
+WHERE permissions.code IN ('texts:write', 'comments:write');
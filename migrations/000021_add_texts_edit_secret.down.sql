@@ -0,0 +1 @@
+ALTER TABLE texts DROP COLUMN IF EXISTS edit_secret_hash;
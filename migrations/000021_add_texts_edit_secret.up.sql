@@ -0,0 +1,3 @@
+-- Anonymous texts can only be updated or deleted with the secret returned when they were created.
+-- Texts created anonymously before this have no secret and can no longer be changed.
+ALTER TABLE texts ADD COLUMN IF NOT EXISTS edit_secret_hash bytea;
@@ -0,0 +1,6 @@
+-- Rate limit buckets are shared by all replicas of the API. The table is unlogged as the buckets
+-- are cheap to lose, which only resets the limits.
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limit_buckets (
+    key text PRIMARY KEY,
+    full_at timestamp with time zone NOT NULL
+);
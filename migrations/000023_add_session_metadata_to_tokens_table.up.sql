@@ -0,0 +1,7 @@
+-- Authentication tokens are listed as sessions, described by where and when they were used
+ALTER TABLE tokens ADD COLUMN created_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+ALTER TABLE tokens ADD COLUMN last_used_at timestamp(0) with time zone;
+ALTER TABLE tokens ADD COLUMN user_agent text NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN ip text NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS tokens_user_id_idx ON tokens (user_id);
@@ -0,0 +1,7 @@
+-- Refresh tokens are rotated on every use. The tokens issued from one login form a family, named by
+-- the ID of its first refresh token, which has no family_id itself. Used refresh tokens are kept
+-- until they expire so that presenting one again can be detected.
+ALTER TABLE tokens ADD COLUMN family_id bigint;
+ALTER TABLE tokens ADD COLUMN used_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS tokens_family_id_idx ON tokens (family_id);
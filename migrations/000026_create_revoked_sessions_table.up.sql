@@ -0,0 +1,7 @@
+-- Sessions revoked before their tokens expired. Signed authentication tokens can't be deleted like
+-- the tokens in the tokens table, so they are refused while their session is listed here. A row is
+-- kept until the last token of its session would have expired.
+CREATE TABLE IF NOT EXISTS revoked_sessions (
+    session_id bigint PRIMARY KEY,
+    expiry timestamp(0) with time zone NOT NULL
+);
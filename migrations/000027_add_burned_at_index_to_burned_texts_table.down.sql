@@ -0,0 +1 @@
+DROP INDEX IF EXISTS burned_texts_burned_at_idx;
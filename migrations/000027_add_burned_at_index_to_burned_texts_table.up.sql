@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS burned_texts_burned_at_idx ON burned_texts (burned_at);